@@ -0,0 +1,218 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+var (
+	apiTagName = "curl" //接口定义的tag，格式为 "GET /users/{id}"
+
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorIfType  = reflect.TypeOf((*error)(nil)).Elem()
+	responseType = reflect.TypeOf((*Response)(nil))
+)
+
+// apiEndpoint 一个接口的定义
+type apiEndpoint struct {
+	name     string
+	method   string
+	path     string
+	reqType  reflect.Type //请求参数的类型，为nil表示没有请求参数
+	outType  reflect.Type //返回数据的类型，为nil表示只返回error
+	withResp bool         //是否返回 *Response
+}
+
+// BindApi 根据接口定义生成请求方法，api为结构体指针，字段为带 curl tag 的函数，比如：
+//
+//	type UserApi struct {
+//		GetUser func(ctx context.Context, req *GetUserReq) (*User, error) `curl:"GET /users/{id}"`
+//	}
+//
+// 函数的第一个参数是 context.Context，第二个参数可选，为请求参数的结构体，字段的tag：
+// path:"id" 替换url模板参数，query:"name,omitempty" url参数，header:"X-Token" 请求头，
+// body:"json" 请求数据，值可以是 json、form、xml 或者 Content-Type，为空时自动判断。
+// 返回值可以是 error、(T, error)、(T, *Response, error)，T按返回的Content-Type解码，
+// 状态码不是2xx时返回 *StatusError，path为相对地址时拼接在 WithBaseURL 后面
+func (c *client) BindApi(api interface{}) error {
+	v := reflect.ValueOf(api)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("api must be a pointer to struct: %T", api)
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup(apiTagName)
+		if !ok {
+			continue
+		}
+		if !field.IsExported() || field.Type.Kind() != reflect.Func {
+			return fmt.Errorf("api %s must be an exported func field", field.Name)
+		}
+		ep, err := newApiEndpoint(field.Name, tag, field.Type)
+		if err != nil {
+			return err
+		}
+		v.Field(i).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) []reflect.Value {
+			return c.callApi(ep, args)
+		}))
+	}
+	return nil
+}
+
+// newApiEndpoint 检查函数的定义
+func newApiEndpoint(name, tag string, fnType reflect.Type) (*apiEndpoint, error) {
+	method, path, ok := strings.Cut(strings.TrimSpace(tag), " ")
+	path = strings.TrimSpace(path)
+	if !ok || method == "" || path == "" {
+		return nil, fmt.Errorf("api %s tag error, format is \"GET /path\": %s", name, tag)
+	}
+	ep := &apiEndpoint{name: name, method: strings.ToUpper(method), path: path}
+
+	if fnType.IsVariadic() || fnType.NumIn() < 1 || fnType.NumIn() > 2 || fnType.In(0) != contextType {
+		return nil, fmt.Errorf("api %s params must be (context.Context[, request])", name)
+	}
+	if fnType.NumIn() == 2 {
+		ep.reqType = fnType.In(1)
+		if indirectType(ep.reqType).Kind() != reflect.Struct {
+			return nil, fmt.Errorf("api %s request must be a struct: %s", name, ep.reqType)
+		}
+	}
+
+	numOut := fnType.NumOut()
+	if numOut < 1 || numOut > 3 || fnType.Out(numOut-1) != errorIfType {
+		return nil, fmt.Errorf("api %s results must be error, (T, error) or (T, *Response, error)", name)
+	}
+	if numOut >= 2 {
+		ep.outType = fnType.Out(0)
+	}
+	if numOut == 3 {
+		if fnType.Out(1) != responseType {
+			return nil, fmt.Errorf("api %s second result must be *curl.Response", name)
+		}
+		ep.withResp = true
+	}
+	return ep, nil
+}
+
+// callApi 实际发起请求
+func (c *client) callApi(ep *apiEndpoint, args []reflect.Value) []reflect.Value {
+	var ctx context.Context
+	if !args[0].IsNil() {
+		ctx = args[0].Interface().(context.Context)
+	}
+	gen := c.NewRequest(&Request{Url: ep.path, Method: ep.method})
+
+	var resp *Response
+	var out reflect.Value
+	if ep.outType != nil {
+		out = reflect.New(ep.outType)
+	}
+	err := func() error {
+		if ep.reqType != nil {
+			if err := bindApiRequest(gen, args[1]); err != nil {
+				return fmt.Errorf("api %s request error: %w", ep.name, err)
+			}
+		}
+		resp = gen.Submit(ctx)
+		var v interface{}
+		if out.IsValid() {
+			v = out.Interface()
+		}
+		return gen.decodeResponse(resp, v)
+	}()
+
+	results := make([]reflect.Value, 0, 3)
+	if out.IsValid() {
+		results = append(results, out.Elem())
+	}
+	if ep.withResp {
+		results = append(results, reflect.ValueOf(resp))
+	}
+	errValue := reflect.New(errorIfType).Elem()
+	if err != nil {
+		errValue.Set(reflect.ValueOf(err))
+	}
+	return append(results, errValue)
+}
+
+// bindApiRequest 根据请求参数字段的tag设置请求
+func bindApiRequest(gen *genRequest, v reflect.Value) error {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil
+	}
+	q := &queryEncoder{arrayStyle: QueryArrayRepeat, nestStyle: QueryNestBracket}
+	query := url.Values{}
+	pathParams := make(map[string]any)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		if name, ok := field.Tag.Lookup("path"); ok {
+			fv = indirectValue(fv)
+			if !fv.IsValid() {
+				return fmt.Errorf("path param %s is nil", name)
+			}
+			pathParams[name] = fv.Interface()
+			continue
+		}
+		if tag, ok := field.Tag.Lookup("query"); ok {
+			name, opts, _ := strings.Cut(tag, ",")
+			if strings.Contains(opts, "omitempty") && fv.IsZero() {
+				continue
+			}
+			if err := q.encode(query, name, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if name, ok := field.Tag.Lookup("header"); ok {
+			values := url.Values{}
+			if err := q.encode(values, name, fv); err != nil {
+				return err
+			}
+			if gen.Header == nil {
+				gen.Header = make(http.Header)
+			}
+			for _, one := range values[name] {
+				gen.Header.Add(name, one)
+			}
+			continue
+		}
+		if codec, ok := field.Tag.Lookup("body"); ok {
+			if gen.Data != nil {
+				return errors.New("only one body field is allowed")
+			}
+			gen.SetData(fv.Interface())
+			switch codec {
+			case "":
+			case "json":
+				gen.SetJSON()
+			case "form":
+				gen.SetForm()
+			case "xml":
+				gen.SetXML()
+			default:
+				gen.SetCodec(codec)
+			}
+		}
+	}
+
+	if len(pathParams) > 0 {
+		gen.SetPathParams(pathParams)
+	}
+	if len(query) > 0 {
+		gen.SetQuery(query)
+	}
+	return nil
+}
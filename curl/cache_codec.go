@@ -0,0 +1,291 @@
+package curl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/magic-lib/go-plat-utils/cache"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	cacheCodecPrefix = "#cc:" //编码后的缓存数据前缀，没有前缀的是旧的明文数据
+
+	defaultCacheCompressMinSize = 1024 //默认超过1K才压缩
+)
+
+// CacheCodec 缓存数据的编码方式，比如压缩、加密
+type CacheCodec interface {
+	// Name 编码名称，会记录在缓存数据中，用来找到解码方式
+	Name() string
+	// Encode 编码，返回false表示没有编码，比如数据小于压缩的阈值
+	Encode(data []byte) ([]byte, bool, error)
+	// Decode 解码
+	Decode(data []byte) ([]byte, error)
+}
+
+// WithCacheCodec 设置缓存数据的编码方式，按顺序编码，压缩需要放在加密的前面
+func (c *client) WithCacheCodec(codecs ...CacheCodec) *client {
+	c.cacheCodecs = codecs
+	return c
+}
+
+// getCacheEntry 读取缓存数据并解码，旧的明文数据直接返回
+func (c *client) getCacheEntry(ctx context.Context, namespace, cacheId string) (string, error) {
+	var retData string
+	var err error
+	if c.cacheStreamStore() != nil {
+		retData, err = c.cacheIns.Get(ctx, cacheEntryKey(namespace, cacheId))
+	} else {
+		retData, err = cache.NsGet[string](ctx, c.cacheIns, namespace, cacheId)
+	}
+	if err != nil || retData == "" {
+		return retData, err
+	}
+	return c.decodeCacheEntry(retData)
+}
+
+// setCacheEntry 编码后写入缓存
+func (c *client) setCacheEntry(ctx context.Context, namespace, cacheId, data string, storeTime time.Duration) (bool, error) {
+	encodeData, err := c.encodeCacheEntry(data)
+	if err != nil {
+		return false, err
+	}
+	if c.cacheStreamStore() != nil {
+		return c.cacheIns.Set(ctx, cacheEntryKey(namespace, cacheId), encodeData, storeTime)
+	}
+	return cache.NsSet[string](ctx, c.cacheIns, namespace, cacheId, encodeData, storeTime)
+}
+
+// delCacheEntry 删除缓存数据
+func (c *client) delCacheEntry(ctx context.Context, namespace, cacheId string) (bool, error) {
+	if c.cacheStreamStore() != nil {
+		return c.cacheIns.Del(ctx, cacheEntryKey(namespace, cacheId))
+	}
+	return cache.NsDel[string](ctx, c.cacheIns, namespace, cacheId)
+}
+
+// encodeCacheEntry 格式为 #cc:gzip,aesgcm:base64数据
+func (c *client) encodeCacheEntry(data string) (string, error) {
+	if len(c.cacheCodecs) == 0 {
+		return data, nil
+	}
+	nameList, b, err := c.encodeCacheBytes([]byte(data))
+	if err != nil {
+		return "", err
+	}
+	if len(nameList) == 0 {
+		return data, nil
+	}
+	return cacheCodecPrefix + strings.Join(nameList, ",") + ":" + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// encodeCacheBytes 按顺序编码，返回实际使用的编码名称
+func (c *client) encodeCacheBytes(b []byte) ([]string, []byte, error) {
+	nameList := make([]string, 0, len(c.cacheCodecs))
+	for _, codec := range c.cacheCodecs {
+		newB, ok, err := codec.Encode(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cache codec %s encode error: %w", codec.Name(), err)
+		}
+		if ok {
+			b = newB
+			nameList = append(nameList, codec.Name())
+		}
+	}
+	return nameList, b, nil
+}
+
+func (c *client) decodeCacheEntry(data string) (string, error) {
+	if !strings.HasPrefix(data, cacheCodecPrefix) {
+		return data, nil
+	}
+	names, body, ok := strings.Cut(strings.TrimPrefix(data, cacheCodecPrefix), ":")
+	if !ok {
+		return "", errors.New("cache codec data format error")
+	}
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", err
+	}
+	if b, err = c.decodeCacheBytes(strings.Split(names, ","), b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// decodeCacheBytes 按编码的倒序解码
+func (c *client) decodeCacheBytes(nameList []string, b []byte) ([]byte, error) {
+	var err error
+	for i := len(nameList) - 1; i >= 0; i-- {
+		codec := c.getCacheCodec(nameList[i])
+		if codec == nil {
+			return nil, fmt.Errorf("cache codec %s not found", nameList[i])
+		}
+		if b, err = codec.Decode(b); err != nil {
+			return nil, fmt.Errorf("cache codec %s decode error: %w", nameList[i], err)
+		}
+	}
+	return b, nil
+}
+
+func (c *client) getCacheCodec(name string) CacheCodec {
+	for _, codec := range c.cacheCodecs {
+		if codec.Name() == name {
+			return codec
+		}
+	}
+	return nil
+}
+
+// gzipCacheCodec gzip压缩
+type gzipCacheCodec struct {
+	minSize int
+}
+
+// NewGzipCacheCodec gzip压缩，超过minSize字节才压缩，为0时使用默认值
+func NewGzipCacheCodec(minSize int) CacheCodec {
+	if minSize <= 0 {
+		minSize = defaultCacheCompressMinSize
+	}
+	return &gzipCacheCodec{minSize: minSize}
+}
+
+func (g *gzipCacheCodec) Name() string {
+	return "gzip"
+}
+
+func (g *gzipCacheCodec) Encode(data []byte) ([]byte, bool, error) {
+	if len(data) < g.minSize {
+		return data, false, nil
+	}
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, false, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+func (g *gzipCacheCodec) Decode(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// zstdCacheCodec zstd压缩
+type zstdCacheCodec struct {
+	minSize int
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewZstdCacheCodec zstd压缩，超过minSize字节才压缩，为0时使用默认值
+func NewZstdCacheCodec(minSize int) (CacheCodec, error) {
+	if minSize <= 0 {
+		minSize = defaultCacheCompressMinSize
+	}
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &zstdCacheCodec{minSize: minSize, encoder: encoder, decoder: decoder}, nil
+}
+
+func (z *zstdCacheCodec) Name() string {
+	return "zstd"
+}
+
+func (z *zstdCacheCodec) Encode(data []byte) ([]byte, bool, error) {
+	if len(data) < z.minSize {
+		return data, false, nil
+	}
+	return z.encoder.EncodeAll(data, nil), true, nil
+}
+
+func (z *zstdCacheCodec) Decode(data []byte) ([]byte, error) {
+	return z.decoder.DecodeAll(data, nil)
+}
+
+// aesGcmCacheCodec AES-GCM加密，密文前带上密钥id，方便更换密钥
+type aesGcmCacheCodec struct {
+	keyId   string
+	aeadMap map[string]cipher.AEAD
+}
+
+// NewAesGcmCacheCodec AES-GCM加密，使用keyId对应的密钥加密，keys中所有的密钥都可以用来解密，
+// 更换密钥时新增一个keyId，旧的密钥保留到旧缓存都过期为止
+func NewAesGcmCacheCodec(keyId string, keys map[string][]byte) (CacheCodec, error) {
+	if _, ok := keys[keyId]; !ok {
+		return nil, fmt.Errorf("aes key %s not found", keyId)
+	}
+	a := &aesGcmCacheCodec{keyId: keyId, aeadMap: make(map[string]cipher.AEAD)}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("aes key id length error: %s", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("aes key %s error: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		a.aeadMap[id] = aead
+	}
+	return a, nil
+}
+
+func (a *aesGcmCacheCodec) Name() string {
+	return "aesgcm"
+}
+
+// Encode 格式为 密钥id长度(1字节) + 密钥id + nonce + 密文
+func (a *aesGcmCacheCodec) Encode(data []byte) ([]byte, bool, error) {
+	aead := a.aeadMap[a.keyId]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, false, err
+	}
+	out := make([]byte, 0, 1+len(a.keyId)+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, byte(len(a.keyId)))
+	out = append(out, a.keyId...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, []byte(a.keyId)), true, nil
+}
+
+func (a *aesGcmCacheCodec) Decode(data []byte) ([]byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, errors.New("aes data too short")
+	}
+	keyId := string(data[1 : 1+int(data[0])])
+	aead, ok := a.aeadMap[keyId]
+	if !ok {
+		return nil, fmt.Errorf("aes key %s not found", keyId)
+	}
+	data = data[1+len(keyId):]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("aes data too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(keyId))
+}
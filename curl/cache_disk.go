@@ -0,0 +1,449 @@
+package curl
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/magic-lib/go-plat-utils/cache"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	defaultDiskMaxBytes int64 = 1 << 30 //磁盘缓存默认最大1G
+	diskTempSuffix            = ".tmp"
+
+	cacheStreamCodecPrefix = "#cs:" //流式写入并且编码的缓存数据前缀，编码后的数据直接写入，不转为base64
+)
+
+var (
+	_ cache.CommCache[string] = (*DiskCache)(nil)
+	_ CacheStreamStore        = (*DiskCache)(nil)
+	_ CacheTTLStore           = (*DiskCache)(nil)
+)
+
+// CacheStreamStore 支持流式读写的缓存，返回内容的缓存直接写入，不需要整体转为json字符串，DiskCache 已实现
+type CacheStreamStore interface {
+	// GetReader 以流的方式读取数据，不存在时返回nil，用完需要Close
+	GetReader(ctx context.Context, key string) (io.ReadCloser, error)
+	// SetReader 以流的方式写入数据，timeout为0表示不过期
+	SetReader(ctx context.Context, key string, r io.Reader, timeout time.Duration) error
+}
+
+// cacheStreamStore 缓存支持流式读写时返回
+func (c *client) cacheStreamStore() CacheStreamStore {
+	if store, ok := c.cacheIns.(CacheStreamStore); ok {
+		return store
+	}
+	return nil
+}
+
+// cacheEntryKey 支持流式读写的缓存，字符串和流使用相同的key
+func cacheEntryKey(namespace, cacheId string) string {
+	return namespace + ":" + cacheId
+}
+
+// setStreamCacheEntry 流式写入缓存，第一行是json格式的元数据，后面直接写入返回内容，
+// 设置了 WithCacheCodec 时整体编码，格式为 #cs:gzip,aesgcm:编码后的数据
+func (c *client) setStreamCacheEntry(ctx context.Context, store CacheStreamStore, key string, meta any, body []byte, storeTime time.Duration) error {
+	metaByte, err := jsoniter.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	metaByte = append(metaByte, '\n')
+	if len(c.cacheCodecs) == 0 {
+		return store.SetReader(ctx, key, io.MultiReader(bytes.NewReader(metaByte), bytes.NewReader(body)), storeTime)
+	}
+	nameList, b, err := c.encodeCacheBytes(append(metaByte, body...))
+	if err != nil {
+		return err
+	}
+	prefix := cacheStreamCodecPrefix + strings.Join(nameList, ",") + ":"
+	return store.SetReader(ctx, key, io.MultiReader(strings.NewReader(prefix), bytes.NewReader(b)), storeTime)
+}
+
+// getStreamCacheEntry 读取流式写入的缓存，返回第一行的元数据和后面的内容，不存在时都为nil，
+// 兼容整体写入的json以及 #cc: 开头的编码数据，这时只有元数据
+func (c *client) getStreamCacheEntry(ctx context.Context, store CacheStreamStore, key string) ([]byte, []byte, error) {
+	rc, err := store.GetReader(ctx, key)
+	if err != nil || rc == nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	br := bufio.NewReader(rc)
+	prefix, _ := br.Peek(len(cacheStreamCodecPrefix))
+	switch string(prefix) {
+	case cacheStreamCodecPrefix:
+		header, err := br.ReadString(':')
+		if err == nil {
+			header, err = br.ReadString(':')
+		}
+		if err != nil {
+			return nil, nil, errors.New("cache codec data format error")
+		}
+		b, err := io.ReadAll(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b, err = c.decodeCacheBytes(strings.Split(strings.TrimSuffix(header, ":"), ","), b); err != nil {
+			return nil, nil, err
+		}
+		line, body, _ := bytes.Cut(b, []byte{'\n'})
+		return line, body, nil
+	case cacheCodecPrefix:
+		b, err := io.ReadAll(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := c.decodeCacheEntry(string(b))
+		if err != nil {
+			return nil, nil, err
+		}
+		return []byte(data), nil, nil
+	}
+	line, err := br.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	return line, body, nil
+}
+
+// diskMeta 缓存文件第一行的元数据
+type diskMeta struct {
+	Key        string    `json:"key"`
+	ExpireTime time.Time `json:"expireTime"` //为空表示不过期
+}
+
+// diskItem 内存中记录的缓存文件信息
+type diskItem struct {
+	name       string
+	size       int64
+	expireTime time.Time
+}
+
+// DiskCache 磁盘缓存，进程重启后依然可用，可用于 client.WithCache
+// 文件名为key的sha256，先写临时文件再rename，避免进程崩溃时留下不完整的数据
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	curBytes int64
+	ll       *list.List               //按访问时间排序，最近访问的在前
+	items    map[string]*list.Element //文件名对应的记录
+}
+
+// NewDiskCache 新建磁盘缓存，maxBytes为所有缓存文件的最大字节数，为0时使用默认值
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if dir == "" {
+		return nil, errors.New("disk cache dir is empty")
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultDiskMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load 启动时扫描目录，删除临时文件和过期文件，按修改时间恢复lru顺序
+func (d *DiskCache) load() error {
+	type fileInfo struct {
+		item    *diskItem
+		modTime time.Time
+	}
+	fileList := make([]fileInfo, 0)
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(path, diskTempSuffix) {
+			_ = os.Remove(path)
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		meta, err := readDiskMeta(path)
+		if err != nil || meta.isExpired() {
+			_ = os.Remove(path)
+			return nil
+		}
+		fileList = append(fileList, fileInfo{
+			item:    &diskItem{name: entry.Name(), size: info.Size(), expireTime: meta.ExpireTime},
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(fileList, func(i, j int) bool {
+		return fileList[i].modTime.Before(fileList[j].modTime)
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, one := range fileList {
+		d.items[one.item.name] = d.ll.PushFront(one.item)
+		d.curBytes += one.item.size
+	}
+	d.evict()
+	return nil
+}
+
+// Get 取得数据，不存在或已过期时返回空字符串
+func (d *DiskCache) Get(ctx context.Context, key string) (string, error) {
+	rc, err := d.GetReader(ctx, key)
+	if err != nil || rc == nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// GetWithTTL 取得数据以及剩余的过期时间，没有过期时间时返回-1，实现 CacheTTLStore
+func (d *DiskCache) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	var ttl time.Duration = -1
+	d.mu.Lock()
+	if ele, ok := d.items[diskFileName(key)]; ok {
+		if expireTime := ele.Value.(*diskItem).expireTime; !expireTime.IsZero() {
+			ttl = max(time.Until(expireTime), 0)
+		}
+	}
+	d.mu.Unlock()
+	val, err := d.Get(ctx, key)
+	return val, ttl, err
+}
+
+// Set 写入数据，timeout为0表示不过期
+func (d *DiskCache) Set(ctx context.Context, key string, val string, timeout time.Duration) (bool, error) {
+	if err := d.SetReader(ctx, key, strings.NewReader(val), timeout); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Del 删除数据
+func (d *DiskCache) Del(_ context.Context, key string) (bool, error) {
+	name := diskFileName(key)
+	d.mu.Lock()
+	ele, ok := d.items[name]
+	if ok {
+		d.removeElement(ele)
+	}
+	d.mu.Unlock()
+
+	err := os.Remove(d.filePath(name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	return ok, nil
+}
+
+// GetReader 以流的方式读取数据，大的数据不需要转为字符串，不存在时返回nil，用完需要Close
+func (d *DiskCache) GetReader(_ context.Context, key string) (io.ReadCloser, error) {
+	name := diskFileName(key)
+	d.mu.Lock()
+	ele, ok := d.items[name]
+	if !ok {
+		d.mu.Unlock()
+		return nil, nil
+	}
+	item := ele.Value.(*diskItem)
+	if !item.expireTime.IsZero() && time.Now().After(item.expireTime) {
+		d.removeElement(ele)
+		d.mu.Unlock()
+		_ = os.Remove(d.filePath(name))
+		return nil, nil
+	}
+	d.ll.MoveToFront(ele)
+	d.mu.Unlock()
+
+	f, err := os.Open(d.filePath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	meta, err := parseDiskMeta(br)
+	if err != nil || meta.Key != key {
+		_ = f.Close()
+		return nil, err
+	}
+	return &diskReader{Reader: br, f: f}, nil
+}
+
+// SetReader 以流的方式写入数据，先写到临时文件，完成后再rename
+func (d *DiskCache) SetReader(_ context.Context, key string, r io.Reader, timeout time.Duration) error {
+	name := diskFileName(key)
+	path := d.filePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	meta := diskMeta{Key: key}
+	if timeout > 0 {
+		meta.ExpireTime = time.Now().Add(timeout)
+	}
+	metaByte, err := jsoniter.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), name+"-*"+diskTempSuffix)
+	if err != nil {
+		return err
+	}
+	size, err := writeDiskFile(tmp, metaByte, r)
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	//rename以后同步目录，进程或机器崩溃后文件依然存在
+	if err = syncDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ele, ok := d.items[name]; ok {
+		d.removeElement(ele)
+	}
+	d.items[name] = d.ll.PushFront(&diskItem{name: name, size: size, expireTime: meta.ExpireTime})
+	d.curBytes += size
+	d.evict()
+	return nil
+}
+
+// Size 当前所有缓存文件的字节数
+func (d *DiskCache) Size() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.curBytes
+}
+
+// evict 超过最大字节数时，删除最久没有访问的文件
+func (d *DiskCache) evict() {
+	for d.curBytes > d.maxBytes && d.ll.Len() > 0 {
+		item := d.ll.Back().Value.(*diskItem)
+		d.removeElement(d.ll.Back())
+		_ = os.Remove(d.filePath(item.name))
+	}
+}
+
+func (d *DiskCache) removeElement(ele *list.Element) {
+	item := d.ll.Remove(ele).(*diskItem)
+	delete(d.items, item.name)
+	d.curBytes -= item.size
+}
+
+// filePath 按文件名前两位分目录，避免单个目录文件太多
+func (d *DiskCache) filePath(name string) string {
+	return filepath.Join(d.dir, name[:2], name)
+}
+
+// diskReader 读取缓存内容，关闭时关闭文件
+type diskReader struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *diskReader) Close() error {
+	return r.f.Close()
+}
+
+func (m *diskMeta) isExpired() bool {
+	return !m.ExpireTime.IsZero() && time.Now().After(m.ExpireTime)
+}
+
+func diskFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeDiskFile 写入元数据以及内容，并同步到磁盘
+func writeDiskFile(f *os.File, metaByte []byte, r io.Reader) (int64, error) {
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if _, err := w.Write(append(metaByte, '\n')); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return 0, err
+	}
+	if err = w.Flush(); err != nil {
+		return 0, err
+	}
+	if err = f.Sync(); err != nil {
+		return 0, err
+	}
+	return int64(len(metaByte)+1) + n, nil
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func readDiskMeta(path string) (*diskMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseDiskMeta(bufio.NewReader(f))
+}
+
+func parseDiskMeta(br *bufio.Reader) (*diskMeta, error) {
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("disk cache meta error: %w", err)
+	}
+	meta := new(diskMeta)
+	if err = jsoniter.Unmarshal(line, meta); err != nil {
+		return nil, fmt.Errorf("disk cache meta error: %w", err)
+	}
+	return meta, nil
+}
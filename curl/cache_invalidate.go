@@ -0,0 +1,257 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/magic-lib/go-plat-utils/cache"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	cacheTagNamespace = "comm-request-tag"
+	cacheUrlTagPrefix = "url:" //url前缀索引使用的tag前缀
+	cacheTagMaxLength = 10000  //不支持集合的缓存，一个tag下最多记录的缓存数，超过的丢弃最早的
+
+	errCacheNotSet      = errors.New("cache instance is nil")
+	errCacheUrlIndexOff = errors.New("cache url index is off, use WithCacheUrlIndex to enable it")
+)
+
+// CacheSetStore 支持集合操作的缓存，tag索引使用集合记录，多个实例并发写入时不会丢失，RedisCache 已实现，
+// 不支持时在进程内加锁读写，只能保证单个进程内的一致
+type CacheSetStore interface {
+	// SAdd 集合中加入members，并设置集合的过期时间
+	SAdd(ctx context.Context, key string, members []string, timeout time.Duration) error
+	// SMembers 取得集合中所有的member，集合不存在时返回空
+	SMembers(ctx context.Context, key string) ([]string, error)
+	// SRem 从集合中删除members
+	SRem(ctx context.Context, key string, members []string) error
+}
+
+// cacheIndexItem tag下记录的一条缓存
+type cacheIndexItem struct {
+	Namespace string `json:"ns"`
+	Key       string `json:"key"`
+}
+
+// WithCacheUrlIndex 缓存时按url的路径层级记录索引，开启后才能使用 InvalidateCacheByPrefix
+func (c *client) WithCacheUrlIndex(b bool) *client {
+	c.cacheUrlIndex = b
+	return c
+}
+
+// InvalidateCache 删除请求对应的缓存，请求参数需要与缓存时的一致，
+// 请求使用了 SetCacheKeyFunc 时，使用 NewRequest(req).SetCacheKeyFunc(f).InvalidateCache(ctx)
+func (c *client) InvalidateCache(ctx context.Context, req *Request) error {
+	if req == nil {
+		return errors.New("request is nil")
+	}
+	return c.NewRequest(req).InvalidateCache(ctx)
+}
+
+// InvalidateCache 删除这个请求对应的缓存，使用请求设置的缓存key方法
+func (g *genRequest) InvalidateCache(ctx context.Context) error {
+	if g.cli.cacheIns == nil {
+		return errCacheNotSet
+	}
+	if err := g.buildGenRequest(); err != nil {
+		return err
+	}
+	cacheId := g.getCacheKey(ctx)
+
+	var errList []error
+	for _, ns := range []string{cacheNamespace, httpCacheNamespace} {
+		if _, err := g.cli.delCacheEntry(ctx, ns, cacheId); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return errors.Join(errList...)
+}
+
+// InvalidateCacheByPrefix 删除url以prefix开头的缓存，prefix按路径层级匹配，比如 https://host/users
+func (c *client) InvalidateCacheByPrefix(ctx context.Context, prefix string) error {
+	if !c.cacheUrlIndex {
+		return errCacheUrlIndexOff
+	}
+	tag, err := urlPrefixTag(prefix)
+	if err != nil {
+		return err
+	}
+	return c.InvalidateCacheByTags(ctx, tag)
+}
+
+// InvalidateCacheByTags 删除打了这些tag的所有缓存
+func (c *client) InvalidateCacheByTags(ctx context.Context, tags ...string) error {
+	if c.cacheIns == nil {
+		return errCacheNotSet
+	}
+	var errList []error
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		if err := c.invalidateTag(ctx, tag); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return errors.Join(errList...)
+}
+
+// invalidateTag 删除tag下的缓存，集合中只删除已经取出的，删除过程中新加入的保留
+func (c *client) invalidateTag(ctx context.Context, tag string) error {
+	var errList []error
+	if store := c.cacheSetStore(); store != nil {
+		members, err := store.SMembers(ctx, cacheTagSetKey(tag))
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			item := cacheIndexItem{}
+			if err = jsoniter.Unmarshal([]byte(member), &item); err != nil {
+				continue
+			}
+			if _, err = c.delCacheEntry(ctx, item.Namespace, item.Key); err != nil {
+				errList = append(errList, err)
+			}
+		}
+		if len(members) > 0 {
+			if err = store.SRem(ctx, cacheTagSetKey(tag), members); err != nil {
+				errList = append(errList, err)
+			}
+		}
+		return errors.Join(errList...)
+	}
+
+	c.tagIndexMu.Lock()
+	defer c.tagIndexMu.Unlock()
+	for _, item := range c.getCacheIndex(ctx, tag) {
+		if _, err := c.delCacheEntry(ctx, item.Namespace, item.Key); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	if _, err := cache.NsDel[string](ctx, c.cacheIns, cacheTagNamespace, tag); err != nil {
+		errList = append(errList, err)
+	}
+	return errors.Join(errList...)
+}
+
+// cacheSetStore 缓存支持集合操作时返回，两级缓存使用L2
+func (c *client) cacheSetStore() CacheSetStore {
+	var store interface{} = c.cacheIns
+	if tiered, ok := c.cacheIns.(*TieredCache); ok {
+		store = tiered.l2
+	}
+	if setStore, ok := store.(CacheSetStore); ok {
+		return setStore
+	}
+	return nil
+}
+
+// cacheTagSetKey tag对应的集合key
+func cacheTagSetKey(tag string) string {
+	return cacheTagNamespace + ":" + tag
+}
+
+// getCacheIndex 不支持集合时，tag下的缓存以json列表保存
+func (c *client) getCacheIndex(ctx context.Context, tag string) []cacheIndexItem {
+	retData, err := cache.NsGet[string](ctx, c.cacheIns, cacheTagNamespace, tag)
+	if err != nil || retData == "" {
+		return nil
+	}
+	itemList := make([]cacheIndexItem, 0)
+	if err = jsoniter.Unmarshal([]byte(retData), &itemList); err != nil {
+		return nil
+	}
+	return itemList
+}
+
+// addCacheIndex 写入缓存前，把缓存key记录到各个tag下，支持集合时使用集合，否则在进程内加锁读写json列表
+func (g *genRequest) addCacheIndex(ctx context.Context, namespace, cacheId string) {
+	tags := append([]string{}, g.cacheTags...)
+	if g.cli.cacheUrlIndex {
+		tags = append(tags, urlIndexTags(g.Url)...)
+	}
+	if len(tags) == 0 {
+		return
+	}
+	newItem := cacheIndexItem{Namespace: namespace, Key: cacheId}
+
+	if store := g.cli.cacheSetStore(); store != nil {
+		member, err := jsoniter.MarshalToString(newItem)
+		if err != nil {
+			return
+		}
+		for _, tag := range tags {
+			_ = store.SAdd(ctx, cacheTagSetKey(tag), []string{member}, defaultMaxCacheTime)
+		}
+		return
+	}
+
+	g.cli.tagIndexMu.Lock()
+	defer g.cli.tagIndexMu.Unlock()
+	for _, tag := range tags {
+		itemList := g.cli.getCacheIndex(ctx, tag)
+		isFind := false
+		for _, one := range itemList {
+			if one == newItem {
+				isFind = true
+				break
+			}
+		}
+		if isFind {
+			continue
+		}
+		itemList = append(itemList, newItem)
+		if len(itemList) > cacheTagMaxLength {
+			itemList = itemList[len(itemList)-cacheTagMaxLength:]
+		}
+		_, _ = cache.NsSet[string](ctx, g.cli.cacheIns, cacheTagNamespace, tag, conv.String(itemList), defaultMaxCacheTime)
+	}
+}
+
+// invalidateTagsAfterSubmit 请求成功以后，删除设置的tag下的缓存，比如修改了用户信息后删除 user:42
+func (g *genRequest) invalidateTagsAfterSubmit(ctx context.Context, resp *Response) {
+	if len(g.invalidateTags) == 0 || resp.Error != nil || resp.StatusCode >= 400 {
+		return
+	}
+	if err := g.cli.InvalidateCacheByTags(ctx, g.invalidateTags...); err != nil {
+		logStr := fmt.Sprintf("[comm-request cache invalidate]id:%s, tags:%v, error:%v", resp.Id, g.invalidateTags, err)
+		printLog(ctx, g.cli.logger, 0, g.defaultPrintLogInt, logStr)
+	}
+}
+
+// urlIndexTags url每一层路径对应的tag，https://host/a/b 对应 host、host/a、host/a/b
+func urlIndexTags(rawUrl string) []string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	base := strings.ToLower(u.Scheme + "://" + u.Host)
+	tags := []string{cacheUrlTagPrefix + base}
+	path := ""
+	for _, seg := range strings.Split(u.Path, "/") {
+		if seg == "" {
+			continue
+		}
+		path += "/" + seg
+		tags = append(tags, cacheUrlTagPrefix+base+path)
+	}
+	return tags
+}
+
+// urlPrefixTag url前缀对应的tag
+func urlPrefixTag(prefix string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(prefix))
+	if err != nil {
+		return "", fmt.Errorf("url格式错误：%s, %v", prefix, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("url前缀需要包含host：%s", prefix)
+	}
+	path := strings.TrimRight(u.Path, "/")
+	return cacheUrlTagPrefix + strings.ToLower(u.Scheme+"://"+u.Host) + path, nil
+}
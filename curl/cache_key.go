@@ -0,0 +1,160 @@
+package curl
+
+import (
+	"context"
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// jsonNumberApi 解析时保留数字的原始格式，避免大整数丢失精度
+var jsonNumberApi = jsoniter.Config{
+	UseNumber: true,
+}.Froze()
+
+// CacheKeyFunc 生成缓存key的方法，相同key的请求共用缓存
+type CacheKeyFunc func(ctx context.Context, req *Request) string
+
+// CacheKeyBuilder 常用缓存key规则的构造器
+type CacheKeyBuilder struct {
+	includeHeaders []string                         //只有这些header参与key的计算，为空表示全部
+	excludeHeaders []string                         //不参与key计算的header
+	ignoreFields   []string                         //不参与key计算的query以及body字段
+	namespaceFunc  func(ctx context.Context) string //按租户等信息区分缓存
+}
+
+// NewCacheKeyBuilder 新建缓存key构造器
+func NewCacheKeyBuilder() *CacheKeyBuilder {
+	return new(CacheKeyBuilder)
+}
+
+// IncludeHeaders 只有指定的header参与key的计算
+func (b *CacheKeyBuilder) IncludeHeaders(names ...string) *CacheKeyBuilder {
+	b.includeHeaders = append(b.includeHeaders, names...)
+	return b
+}
+
+// ExcludeHeaders 指定的header不参与key的计算，比如 X-Request-Id
+func (b *CacheKeyBuilder) ExcludeHeaders(names ...string) *CacheKeyBuilder {
+	b.excludeHeaders = append(b.excludeHeaders, names...)
+	return b
+}
+
+// IgnoreFields url参数以及body中第一层的字段不参与key的计算，比如 nonce、timestamp、sign
+func (b *CacheKeyBuilder) IgnoreFields(fields ...string) *CacheKeyBuilder {
+	b.ignoreFields = append(b.ignoreFields, fields...)
+	return b
+}
+
+// Namespace 按ctx中取得的租户等信息给key加上前缀
+func (b *CacheKeyBuilder) Namespace(f func(ctx context.Context) string) *CacheKeyBuilder {
+	b.namespaceFunc = f
+	return b
+}
+
+// NamespaceFromCtx 使用ctx中key对应的值作为前缀
+func (b *CacheKeyBuilder) NamespaceFromCtx(key any) *CacheKeyBuilder {
+	return b.Namespace(func(ctx context.Context) string {
+		if ctx == nil {
+			return ""
+		}
+		if v := ctx.Value(key); v != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return ""
+	})
+}
+
+// Build 生成缓存key的方法
+func (b *CacheKeyBuilder) Build() CacheKeyFunc {
+	return func(ctx context.Context, req *Request) string {
+		newReq := &Request{
+			Url:    b.filterUrl(req.Url),
+			Data:   b.filterData(req.Data),
+			Method: req.Method,
+			Header: b.filterHeader(req.Header),
+		}
+		key := getRequestId(newReq)
+		if b.namespaceFunc != nil {
+			if ns := b.namespaceFunc(ctx); ns != "" {
+				key = ns + ":" + key
+			}
+		}
+		return key
+	}
+}
+
+func (b *CacheKeyBuilder) filterHeader(h http.Header) http.Header {
+	if h == nil || (len(b.includeHeaders) == 0 && len(b.excludeHeaders) == 0) {
+		return h
+	}
+	newHeader := http.Header{}
+	for k, v := range h {
+		if len(b.includeHeaders) > 0 && !containsHeaderKey(b.includeHeaders, k) {
+			continue
+		}
+		if containsHeaderKey(b.excludeHeaders, k) {
+			continue
+		}
+		newHeader[k] = v
+	}
+	return newHeader
+}
+
+func (b *CacheKeyBuilder) filterUrl(rawUrl string) string {
+	if len(b.ignoreFields) == 0 {
+		return rawUrl
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.RawQuery == "" {
+		return rawUrl
+	}
+	query := u.Query()
+	for _, field := range b.ignoreFields {
+		query.Del(field)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// filterData json数据去掉第一层的字段，不是json的按表单格式处理，数字保留原始格式，避免大整数的key相同
+func (b *CacheKeyBuilder) filterData(data interface{}) interface{} {
+	if len(b.ignoreFields) == 0 || data == nil {
+		return data
+	}
+	dataString, err := getDataString(data)
+	if err != nil || dataString == "" {
+		return data
+	}
+
+	dataMap := make(map[string]interface{})
+	if err = jsonNumberApi.Unmarshal([]byte(dataString), &dataMap); err == nil {
+		for _, field := range b.ignoreFields {
+			delete(dataMap, field)
+		}
+		return dataMap
+	}
+
+	if strings.Contains(dataString, "=") {
+		if query, err := url.ParseQuery(dataString); err == nil {
+			for _, field := range b.ignoreFields {
+				query.Del(field)
+			}
+			return query.Encode()
+		}
+	}
+	return data
+}
+
+// getCacheKey 取得请求的缓存key，没有设置方法时使用请求id
+func (g *genRequest) getCacheKey(ctx context.Context) string {
+	req := g.getNewRequest()
+	if g.cacheKeyFunc != nil {
+		if key := g.cacheKeyFunc(ctx, req); key != "" {
+			return key
+		}
+	}
+	return getRequestId(req)
+}
@@ -0,0 +1,83 @@
+package curl
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruEntry lru中的一条数据
+type lruEntry struct {
+	key        string
+	value      string
+	expireTime time.Time
+}
+
+// lruCache 按字节数限制大小的内存lru缓存
+type lruCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newLruCache(maxBytes int64) *lruCache {
+	return &lruCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (e *lruEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func (l *lruCache) get(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ele, ok := l.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := ele.Value.(*lruEntry)
+	if time.Now().After(entry.expireTime) {
+		l.removeElement(ele)
+		return "", false
+	}
+	l.ll.MoveToFront(ele)
+	return entry.value, true
+}
+
+// set 写入数据，单条超过最大字节数的不保存
+func (l *lruCache) set(key, value string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ele, ok := l.items[key]; ok {
+		l.removeElement(ele)
+	}
+	entry := &lruEntry{key: key, value: value, expireTime: time.Now().Add(ttl)}
+	if ttl <= 0 || entry.size() > l.maxBytes {
+		return
+	}
+	l.items[key] = l.ll.PushFront(entry)
+	l.curBytes += entry.size()
+	for l.curBytes > l.maxBytes {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+func (l *lruCache) del(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ele, ok := l.items[key]; ok {
+		l.removeElement(ele)
+	}
+}
+
+func (l *lruCache) removeElement(ele *list.Element) {
+	entry := l.ll.Remove(ele).(*lruEntry)
+	delete(l.items, entry.key)
+	l.curBytes -= entry.size()
+}
@@ -0,0 +1,44 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/goroutines"
+	"sync"
+)
+
+// Prefetch 预热缓存，并发发起请求并同步写入缓存，用于启动时加载热点数据，请求需要设置缓存时间
+func (c *client) Prefetch(ctx context.Context, gens ...*genRequest) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	errList := make([]error, len(gens))
+	wg := sync.WaitGroup{}
+	for i, gen := range gens {
+		if gen == nil {
+			continue
+		}
+		if gen.cacheTime <= 0 && gen.httpCacheMode == HttpCacheClose {
+			errList[i] = fmt.Errorf("prefetch %s: cache time not set", gen.Url)
+			continue
+		}
+		//使用拷贝，调用方的请求以后还可以正常读取缓存
+		gen := gen.clone()
+		gen.setClient(c)
+		gen.cacheRefresh = true
+		gen.cacheSync = true
+		wg.Add(1)
+		goroutines.GoAsync(func(params ...interface{}) {
+			defer wg.Done()
+			resp := gen.Submit(ctx)
+			if resp.Error != nil {
+				errList[i] = fmt.Errorf("prefetch %s: %w", gen.Url, resp.Error)
+			} else if gen.httpCacheMode == HttpCacheClose && !gen.canSaveCache(resp) {
+				errList[i] = fmt.Errorf("prefetch %s: response can not be cached, status: %d", gen.Url, resp.StatusCode)
+			}
+		})
+	}
+	wg.Wait()
+	return errors.Join(errList...)
+}
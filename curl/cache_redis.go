@@ -0,0 +1,264 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/magic-lib/go-plat-utils/cache"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	defaultRedisPrefix      = "go-plat-curl:"
+	defaultRedisDegradeTime = 5 * time.Second //redis连不上以后，这段时间内不再访问
+
+	ErrRedisUnavailable = errors.New("redis is unavailable")
+)
+
+var (
+	_ cache.CommCache[string] = (*RedisCache)(nil)
+	_ CacheSetStore           = (*RedisCache)(nil)
+	_ CacheTTLStore           = (*RedisCache)(nil)
+)
+
+// RedisCache 基于redis的缓存，可用于 client.WithCache，多个实例之间共享缓存
+type RedisCache struct {
+	cli         redis.UniversalClient
+	prefix      string
+	degradeTime time.Duration
+	failUntil   atomic.Int64 //连不上redis时，在这个时间点之前直接返回错误，避免每次请求都等待超时
+}
+
+// NewRedisCache 新建redis缓存，prefix为所有key的前缀，为空时使用默认前缀
+func NewRedisCache(cli redis.UniversalClient, prefix string) *RedisCache {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &RedisCache{
+		cli:         cli,
+		prefix:      prefix,
+		degradeTime: defaultRedisDegradeTime,
+	}
+}
+
+// SetDegradeTime 设置redis连不上以后暂停访问的时间
+func (r *RedisCache) SetDegradeTime(d time.Duration) *RedisCache {
+	r.degradeTime = d
+	return r
+}
+
+// Get 取得数据，key不存在时返回空字符串
+func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	if err := r.checkAvailable(); err != nil {
+		return "", err
+	}
+	val, err := r.cli.Get(ctx, r.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		r.markError(err)
+		return "", err
+	}
+	return val, nil
+}
+
+// GetWithTTL 取得数据以及剩余的过期时间，没有过期时间时返回-1，实现 CacheTTLStore
+func (r *RedisCache) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	if err := r.checkAvailable(); err != nil {
+		return "", 0, err
+	}
+	var getCmd *redis.StringCmd
+	var ttlCmd *redis.DurationCmd
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		getCmd = pipe.Get(ctx, r.prefix+key)
+		ttlCmd = pipe.PTTL(ctx, r.prefix+key)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		r.markError(err)
+		return "", 0, err
+	}
+	val, err := getCmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	ttl := ttlCmd.Val()
+	if ttl < 0 {
+		ttl = -1
+	}
+	return val, ttl, nil
+}
+
+// Set 写入数据，timeout为0表示不过期
+func (r *RedisCache) Set(ctx context.Context, key string, val string, timeout time.Duration) (bool, error) {
+	if err := r.checkAvailable(); err != nil {
+		return false, err
+	}
+	if err := r.cli.Set(ctx, r.prefix+key, val, timeout).Err(); err != nil {
+		r.markError(err)
+		return false, err
+	}
+	return true, nil
+}
+
+// Del 删除数据
+func (r *RedisCache) Del(ctx context.Context, key string) (bool, error) {
+	if err := r.checkAvailable(); err != nil {
+		return false, err
+	}
+	n, err := r.cli.Del(ctx, r.prefix+key).Result()
+	if err != nil {
+		r.markError(err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// MGet 批量取得数据，不存在的key不会出现在返回值中
+func (r *RedisCache) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	retMap := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return retMap, nil
+	}
+	if err := r.checkAvailable(); err != nil {
+		return retMap, err
+	}
+	cmdList := make([]*redis.StringCmd, len(keys))
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmdList[i] = pipe.Get(ctx, r.prefix+key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		r.markError(err)
+		return retMap, err
+	}
+	for i, cmd := range cmdList {
+		if val, err := cmd.Result(); err == nil {
+			retMap[keys[i]] = val
+		}
+	}
+	return retMap, nil
+}
+
+// MSet 批量写入数据，使用相同的过期时间
+func (r *RedisCache) MSet(ctx context.Context, data map[string]string, timeout time.Duration) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := r.checkAvailable(); err != nil {
+		return err
+	}
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, val := range data {
+			pipe.Set(ctx, r.prefix+key, val, timeout)
+		}
+		return nil
+	})
+	if err != nil {
+		r.markError(err)
+	}
+	return err
+}
+
+// MDel 批量删除数据
+func (r *RedisCache) MDel(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := r.checkAvailable(); err != nil {
+		return err
+	}
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = r.prefix + key
+	}
+	if err := r.cli.Del(ctx, fullKeys...).Err(); err != nil {
+		r.markError(err)
+		return err
+	}
+	return nil
+}
+
+// SAdd 集合中加入members，并设置集合的过期时间，实现 CacheSetStore
+func (r *RedisCache) SAdd(ctx context.Context, key string, members []string, timeout time.Duration) error {
+	if len(members) == 0 {
+		return nil
+	}
+	if err := r.checkAvailable(); err != nil {
+		return err
+	}
+	args := make([]interface{}, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, r.prefix+key, args...)
+		if timeout > 0 {
+			pipe.Expire(ctx, r.prefix+key, timeout)
+		}
+		return nil
+	})
+	if err != nil {
+		r.markError(err)
+	}
+	return err
+}
+
+// SMembers 取得集合中所有的member
+func (r *RedisCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	if err := r.checkAvailable(); err != nil {
+		return nil, err
+	}
+	members, err := r.cli.SMembers(ctx, r.prefix+key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		r.markError(err)
+		return nil, err
+	}
+	return members, nil
+}
+
+// SRem 从集合中删除members
+func (r *RedisCache) SRem(ctx context.Context, key string, members []string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	if err := r.checkAvailable(); err != nil {
+		return err
+	}
+	args := make([]interface{}, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	if err := r.cli.SRem(ctx, r.prefix+key, args...).Err(); err != nil {
+		r.markError(err)
+		return err
+	}
+	return nil
+}
+
+func (r *RedisCache) checkAvailable() error {
+	if r.cli == nil {
+		return ErrRedisUnavailable
+	}
+	if time.Now().UnixNano() < r.failUntil.Load() {
+		return ErrRedisUnavailable
+	}
+	return nil
+}
+
+// markError 网络错误时，暂停访问redis一段时间
+func (r *RedisCache) markError(err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, redis.ErrClosed) {
+		r.failUntil.Store(time.Now().Add(r.degradeTime).UnixNano())
+	}
+}
@@ -0,0 +1,160 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/magic-lib/go-plat-utils/cache"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	defaultTieredMaxBytes int64 = 64 << 20         //L1默认最大64M
+	defaultTieredL1Time         = 10 * time.Second //L1默认缓存时间，控制与L2不一致的时长
+)
+
+var _ cache.CommCache[string] = (*TieredCache)(nil)
+
+// CacheTTLStore 读取时可以同时返回剩余过期时间的缓存，两级缓存的L1不会比L2晚过期，RedisCache、DiskCache 已实现
+type CacheTTLStore interface {
+	// GetWithTTL 取得数据以及剩余的过期时间，不存在时返回空字符串，没有过期时间时返回-1
+	GetWithTTL(ctx context.Context, key string) (string, time.Duration, error)
+}
+
+// TieredCacheStats 各层缓存的命中统计
+type TieredCacheStats struct {
+	L1Hits   int64 `json:"l1Hits"`
+	L1Misses int64 `json:"l1Misses"`
+	L2Hits   int64 `json:"l2Hits"`
+	L2Misses int64 `json:"l2Misses"`
+	L2Errors int64 `json:"l2Errors"`
+}
+
+// TieredCache 两级缓存，进程内lru在前，共享的远程缓存在后，读穿透并且写穿透
+type TieredCache struct {
+	l1     *lruCache
+	l2     cache.CommCache[string]
+	l1Time time.Duration
+
+	l1Hits   atomic.Int64
+	l1Misses atomic.Int64
+	l2Hits   atomic.Int64
+	l2Misses atomic.Int64
+	l2Errors atomic.Int64
+}
+
+// NewTieredCache 两级缓存，maxBytes为L1最大字节数，l1Time为L1的缓存时间，为0时使用默认值
+func NewTieredCache(remote cache.CommCache[string], maxBytes int64, l1Time time.Duration) *TieredCache {
+	if maxBytes <= 0 {
+		maxBytes = defaultTieredMaxBytes
+	}
+	if l1Time <= 0 {
+		l1Time = defaultTieredL1Time
+	}
+	return &TieredCache{
+		l1:     newLruCache(maxBytes),
+		l2:     remote,
+		l1Time: l1Time,
+	}
+}
+
+// WithTieredCache 使用两级缓存，remote为共享的远程缓存
+func (c *client) WithTieredCache(remote cache.CommCache[string], maxBytes int64, l1Time time.Duration) *client {
+	return c.WithCache(NewTieredCache(remote, maxBytes, l1Time))
+}
+
+// Get 先读L1，没有再读L2并回写L1，L2支持 CacheTTLStore 时L1的缓存时间不超过L2剩余的时间
+func (t *TieredCache) Get(ctx context.Context, key string) (string, error) {
+	if val, ok := t.l1.get(key); ok {
+		t.l1Hits.Add(1)
+		return val, nil
+	}
+	t.l1Misses.Add(1)
+	if t.l2 == nil {
+		return "", nil
+	}
+
+	val, ttl, err := t.getL2(ctx, key)
+	if err != nil {
+		if !isCacheUnavailable(err) {
+			//有的缓存不存在时返回错误，当作没有命中
+			t.l2Misses.Add(1)
+			return "", nil
+		}
+		t.l2Errors.Add(1)
+		return "", err
+	}
+	if val == "" {
+		t.l2Misses.Add(1)
+		return "", nil
+	}
+	t.l2Hits.Add(1)
+	l1Time := t.l1Time
+	if ttl >= 0 && ttl < l1Time {
+		l1Time = ttl
+	}
+	t.l1.set(key, val, l1Time)
+	return val, nil
+}
+
+// getL2 读取L2，不支持返回过期时间时，按没有过期时间处理
+func (t *TieredCache) getL2(ctx context.Context, key string) (string, time.Duration, error) {
+	if store, ok := t.l2.(CacheTTLStore); ok {
+		return store.GetWithTTL(ctx, key)
+	}
+	val, err := t.l2.Get(ctx, key)
+	return val, -1, err
+}
+
+// Set 先写L2再写L1，L1的缓存时间不超过l1Time
+func (t *TieredCache) Set(ctx context.Context, key string, val string, timeout time.Duration) (bool, error) {
+	if t.l2 != nil {
+		ok, err := t.l2.Set(ctx, key, val, timeout)
+		if err != nil {
+			t.l2Errors.Add(1)
+			t.l1.del(key)
+			return ok, err
+		}
+	}
+	l1Time := t.l1Time
+	if timeout > 0 && timeout < l1Time {
+		l1Time = timeout
+	}
+	t.l1.set(key, val, l1Time)
+	return true, nil
+}
+
+// Del 两级同时删除，其他进程的L1只能等过期
+func (t *TieredCache) Del(ctx context.Context, key string) (bool, error) {
+	t.l1.del(key)
+	if t.l2 == nil {
+		return true, nil
+	}
+	ok, err := t.l2.Del(ctx, key)
+	if err != nil {
+		t.l2Errors.Add(1)
+	}
+	return ok, err
+}
+
+// isCacheUnavailable 缓存服务不可用的错误，其他错误当作没有命中
+func isCacheUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, ErrRedisUnavailable) || errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Stats 各层缓存的命中统计
+func (t *TieredCache) Stats() TieredCacheStats {
+	return TieredCacheStats{
+		L1Hits:   t.l1Hits.Load(),
+		L1Misses: t.l1Misses.Load(),
+		L2Hits:   t.l2Hits.Load(),
+		L2Misses: t.l2Misses.Load(),
+		L2Errors: t.l2Errors.Load(),
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/magic-lib/go-plat-utils/conf"
 	"github.com/magic-lib/go-plat-utils/logs"
 	"net/http"
+	"net/url"
+	"sync"
 )
 
 type InjectHandler interface {
@@ -23,6 +25,23 @@ type client struct {
 	clientHasChanged bool                    //client是否改变
 	cacheIns         cache.CommCache[string] //缓存对象
 	logger           logs.ILogger
+	singleFlight     bool               //相同缓存key的并发请求是否合并为一次
+	cacheKeyFunc     CacheKeyFunc       //默认生成缓存key的方法
+	cacheUrlIndex    bool               //是否按url路径记录缓存索引
+	cacheCodecs      []CacheCodec       //缓存数据的编码方式
+	baseUrl          string             //基础地址，相对地址的请求拼接在后面
+	defaultHeader    http.Header        //默认的header
+	defaultQuery     url.Values         //默认的url参数
+	userAgent        string             //默认的User-Agent
+	flightGroup      *singleFlightGroup //合并请求的分组
+	codecs           map[string]Codec   //按media type注册的codec
+
+	compressHosts map[string]*compressConfig //按host设置的请求压缩方式
+
+	tagIndexMu    sync.Mutex //缓存不支持集合时，tag索引的读写需要加锁
+	refreshingIds sync.Map   //正在后台刷新的缓存key，避免同一个key同时多次刷新
+
+	maxDecodedSize int64 //解压后返回内容的最大字节数，0 使用默认值，小于0 不限制
 }
 
 // NewClient 客户端
@@ -31,6 +50,7 @@ func NewClient() *client {
 	c.initHttpClientCfg()
 	//初始化内存cache
 	c.cacheIns = cache.NewMemGoCache[string](defaultMaxCacheTime, cacheCleanupInterval)
+	c.flightGroup = new(singleFlightGroup)
 	return c
 }
 
@@ -40,12 +60,32 @@ func (c *client) WithHandler(h InjectHandler) *client {
 	return c
 }
 
+// getHandler 取得执行前后方法，没有设置时使用全局的
+func (c *client) getHandler() InjectHandler {
+	if c.handler != nil {
+		return c.handler
+	}
+	return defaultHandler
+}
+
 // WithCache 设置缓存实例
 func (c *client) WithCache(cIns cache.CommCache[string]) *client {
 	c.cacheIns = cIns
 	return c
 }
 
+// WithSingleFlight 设置默认是否合并相同缓存key的并发请求，只对GET、HEAD或者开启了缓存的请求生效，可通过 SetSingleFlight 覆盖
+func (c *client) WithSingleFlight(b bool) *client {
+	c.singleFlight = b
+	return c
+}
+
+// WithCacheKeyFunc 设置默认生成缓存key的方法，可通过 SetCacheKeyFunc 覆盖
+func (c *client) WithCacheKeyFunc(f CacheKeyFunc) *client {
+	c.cacheKeyFunc = f
+	return c
+}
+
 func (c *client) NewRequest(r *Request) *genRequest {
 	gen := genRequestFromRequest(r)
 	if c.clientHasChanged || c.httpCli == nil { // 如果改变了，则需要重新设置
@@ -62,6 +102,8 @@ func (c *client) NewRequest(r *Request) *genRequest {
 		gen.defaultPrintLogInt = PrintAll
 	}
 
+	gen.singleFlight = c.singleFlight
+	gen.cacheKeyFunc = c.cacheKeyFunc
 	gen.setClient(c)
 	return gen
 }
@@ -0,0 +1,164 @@
+package curl
+
+import (
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var headerUserAgent = "User-Agent"
+
+// WithBaseURL 设置基础地址，请求的相对地址会拼接在基础地址的路径后面，
+// 比如 https://host/v1 与 users/1 或 /users/1 都得到 https://host/v1/users/1，绝对地址不受影响
+func (c *client) WithBaseURL(baseUrl string) *client {
+	c.baseUrl = strings.TrimSpace(baseUrl)
+	return c
+}
+
+// WithDefaultHeaders 设置所有请求默认的header，请求中已经设置的header优先
+func (c *client) WithDefaultHeaders(headers map[string]string) *client {
+	if c.defaultHeader == nil {
+		c.defaultHeader = make(http.Header)
+	}
+	for k, v := range headers {
+		c.defaultHeader.Set(k, v)
+	}
+	return c
+}
+
+// WithDefaultQuery 设置所有请求默认的url参数，url中或GET的data中已经有的参数优先
+func (c *client) WithDefaultQuery(query url.Values) *client {
+	if c.defaultQuery == nil {
+		c.defaultQuery = make(url.Values)
+	}
+	for k, v := range query {
+		c.defaultQuery[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// WithUserAgent 设置默认的User-Agent，优先级高于 WithDefaultHeaders，低于请求中设置的header
+func (c *client) WithUserAgent(ua string) *client {
+	c.userAgent = ua
+	return c
+}
+
+// mergeClientDefault 合并client的默认设置，优先级：请求设置 > client默认设置
+func (g *genRequest) mergeClientDefault() error {
+	if g.cli == nil {
+		return nil
+	}
+	if g.cli.baseUrl != "" {
+		newUrl, err := resolveBaseUrl(g.cli.baseUrl, g.Url)
+		if err != nil {
+			return err
+		}
+		g.Url = newUrl
+	}
+	if len(g.cli.defaultQuery) > 0 && g.Url != "" {
+		newUrl, err := g.mergeDefaultQuery(g.cli.defaultQuery)
+		if err != nil {
+			return err
+		}
+		g.Url = newUrl
+	}
+
+	if g.cli.userAgent == "" && len(g.cli.defaultHeader) == 0 {
+		return nil
+	}
+	//header可能是调用方传入的，不能直接修改
+	g.Header = g.Header.Clone()
+	if g.Header == nil {
+		g.Header = make(http.Header)
+	}
+	if g.cli.userAgent != "" && g.Header.Get(headerUserAgent) == "" {
+		g.Header.Set(headerUserAgent, g.cli.userAgent)
+	}
+	for k, v := range g.cli.defaultHeader {
+		if len(g.Header.Values(k)) > 0 {
+			continue
+		}
+		g.Header[k] = append([]string(nil), v...)
+	}
+	return nil
+}
+
+// mergeDefaultQuery 默认参数加到url中，url以及放在url参数中的data已有的参数不添加
+func (g *genRequest) mergeDefaultQuery(defaultQuery url.Values) (string, error) {
+	u, err := url.Parse(g.Url)
+	if err != nil {
+		return "", fmt.Errorf("url格式错误：%s, %v", g.Url, err)
+	}
+	query := u.Query()
+
+	dataKeys := make(map[string]interface{})
+	if methodDataInQuery(g.Method) {
+		if dataString, err := getDataString(g.Data); err == nil && dataString != "" {
+			if jsoniter.Unmarshal([]byte(dataString), &dataKeys) != nil {
+				if values, err := url.ParseQuery(dataString); err == nil {
+					for k := range values {
+						dataKeys[k] = nil
+					}
+				}
+			}
+		}
+	}
+
+	isChange := false
+	for k, v := range defaultQuery {
+		if query.Has(k) {
+			continue
+		}
+		if _, ok := dataKeys[k]; ok {
+			continue
+		}
+		query[k] = append([]string(nil), v...)
+		isChange = true
+	}
+	if !isChange {
+		return g.Url, nil
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// resolveBaseUrl 相对地址拼接到基础地址的路径后面，绝对地址直接返回，//host 开头的使用基础地址的scheme
+func resolveBaseUrl(baseUrl, reqUrl string) (string, error) {
+	reqUrl = strings.TrimSpace(reqUrl)
+	rel, err := url.Parse(reqUrl)
+	if err != nil {
+		return "", fmt.Errorf("url格式错误：%s, %v", reqUrl, err)
+	}
+	if rel.IsAbs() {
+		return reqUrl, nil
+	}
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return "", fmt.Errorf("base url格式错误：%s, %v", baseUrl, err)
+	}
+	if reqUrl == "" {
+		return base.String(), nil
+	}
+	if rel.Host != "" {
+		return base.ResolveReference(rel).String(), nil
+	}
+
+	newUrl := *base
+	if relPath := strings.TrimLeft(rel.Path, "/"); relPath != "" {
+		newUrl.Path = strings.TrimRight(base.Path, "/") + "/" + relPath
+		newUrl.RawPath = strings.TrimRight(base.EscapedPath(), "/") + "/" + strings.TrimLeft(rel.EscapedPath(), "/")
+	}
+	if rel.RawQuery != "" {
+		if newUrl.RawQuery != "" {
+			newUrl.RawQuery += "&" + rel.RawQuery
+		} else {
+			newUrl.RawQuery = rel.RawQuery
+		}
+	}
+	if rel.Fragment != "" {
+		newUrl.Fragment = rel.Fragment
+	}
+	return newUrl.String(), nil
+}
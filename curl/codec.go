@@ -0,0 +1,226 @@
+package curl
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	mediaTypeJson = "application/json"
+	mediaTypeXml  = "application/xml"
+	mediaTypeForm = "application/x-www-form-urlencoded"
+	mediaTypeText = "text/plain"
+)
+
+var (
+	codecMutex    sync.RWMutex
+	defaultCodecs = map[string]Codec{
+		mediaTypeJson: new(jsonCodec),
+		mediaTypeXml:  new(xmlCodec),
+		"text/xml":    new(xmlCodec),
+		mediaTypeForm: new(formCodec),
+		mediaTypeText: new(textCodec),
+	}
+)
+
+// Codec 请求和返回数据的编解码，按media type注册，比如 protobuf、msgpack、yaml
+type Codec interface {
+	// Marshal 请求数据编码
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal 返回数据解码
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecValidator 检查返回数据格式的方法，没有实现时解码到 interface{} 来检查
+type CodecValidator interface {
+	Valid(data []byte) error
+}
+
+// RegisterCodec 注册全局的codec，mediaType不包含参数，比如 application/x-msgpack
+func RegisterCodec(mediaType string, codec Codec) {
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+	defaultCodecs[strings.ToLower(mediaType)] = codec
+}
+
+// WithCodec 注册client的codec，优先于全局注册的
+func (c *client) WithCodec(mediaType string, codec Codec) *client {
+	if c.codecs == nil {
+		c.codecs = make(map[string]Codec)
+	}
+	c.codecs[strings.ToLower(mediaType)] = codec
+	return c
+}
+
+// getCodec 根据Content-Type找到codec，找不到时 +json、+xml 的类型使用json、xml的codec
+func (c *client) getCodec(contentType string) Codec {
+	mediaType := parseMediaType(contentType)
+	if mediaType == "" {
+		return nil
+	}
+	if codec := c.findCodec(mediaType); codec != nil {
+		return codec
+	}
+	if strings.HasSuffix(mediaType, "+json") {
+		return c.findCodec(mediaTypeJson)
+	}
+	if strings.HasSuffix(mediaType, "+xml") {
+		return c.findCodec(mediaTypeXml)
+	}
+	return nil
+}
+
+func (c *client) findCodec(mediaType string) Codec {
+	if c != nil {
+		if codec, ok := c.codecs[mediaType]; ok {
+			return codec
+		}
+	}
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+	return defaultCodecs[mediaType]
+}
+
+// parseMediaType 去掉Content-Type的参数，比如 application/json; charset=utf-8
+func parseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(contentType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// validCodecData 检查数据是否能用codec解码
+func validCodecData(codec Codec, data []byte) error {
+	if v, ok := codec.(CodecValidator); ok {
+		return v.Valid(data)
+	}
+	var obj interface{}
+	return codec.Unmarshal(data, &obj)
+}
+
+// jsonCodec json，字符串直接提交
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	str, err := getDataString(v)
+	return []byte(str), err
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return jsonApi.Unmarshal(data, v)
+}
+
+// xmlCodec xml，字符串直接提交
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	str, err := encodeXmlBody(v)
+	return []byte(str), err
+}
+
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// Valid xml不能解码到 interface{}，逐个读取token检查
+func (xmlCodec) Valid(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	hasElement := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			if !hasElement {
+				return errors.New("xml has no element")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			hasElement = true
+		}
+	}
+}
+
+// formCodec x-www-form-urlencoded，嵌套和数组的格式可通过 SetQueryStyle 设置
+type formCodec struct {
+	encoder *queryEncoder
+}
+
+func (f formCodec) Marshal(v interface{}) ([]byte, error) {
+	str, err := encodeFormBody(v, f.encoder)
+	return []byte(str), err
+}
+
+// Unmarshal 支持 *url.Values、*map[string][]string、*map[string]string，其他类型通过json转换
+func (formCodec) Unmarshal(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case *url.Values:
+		*val = values
+		return nil
+	case *map[string][]string:
+		*val = values
+		return nil
+	case *map[string]string:
+		*val = make(map[string]string, len(values))
+		for k := range values {
+			(*val)[k] = values.Get(k)
+		}
+		return nil
+	}
+	oneMap := make(map[string]interface{}, len(values))
+	for k, list := range values {
+		if len(list) == 1 {
+			oneMap[k] = list[0]
+		} else {
+			oneMap[k] = list
+		}
+	}
+	b, err := jsonApi.Marshal(oneMap)
+	if err != nil {
+		return err
+	}
+	return jsonApi.Unmarshal(b, v)
+}
+
+// textCodec 纯文本
+type textCodec struct{}
+
+func (textCodec) Marshal(v interface{}) ([]byte, error) {
+	switch val := v.(type) {
+	case string:
+		return []byte(val), nil
+	case []byte:
+		return val, nil
+	case fmt.Stringer:
+		return []byte(val.String()), nil
+	}
+	return []byte(fmt.Sprint(v)), nil
+}
+
+func (textCodec) Unmarshal(data []byte, v interface{}) error {
+	switch val := v.(type) {
+	case *string:
+		*val = string(data)
+	case *[]byte:
+		*val = append([]byte(nil), data...)
+	case *interface{}:
+		*val = string(data)
+	default:
+		return fmt.Errorf("text codec 不支持的类型: %T", v)
+	}
+	return nil
+}
@@ -1,12 +1,32 @@
 package curl_test
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/andybalholm/brotli"
+	"github.com/go-redis/redis/v8"
+	"github.com/klauspost/compress/zstd"
 	"github.com/magic-lib/go-plat-curl/curl"
+	"github.com/magic-lib/go-plat-utils/cache"
 	"github.com/magic-lib/go-plat-utils/conf"
 	"github.com/magic-lib/go-plat-utils/goroutines"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -20,6 +40,18 @@ var data = map[string]interface{}{
 
 var defaultClient = curl.NewClient()
 
+// waitUntil 缓存是异步写入的，等待条件满足
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("wait timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestGetResponseWithCache(t *testing.T) {
 	conf.SetEnv(conf.EnvLoc)
 	_ = defaultClient.NewRequest(&curl.Request{
@@ -141,3 +173,1589 @@ func TestSetDefaultClient(t *testing.T) {
 		Header: nil,
 	}).Submit(nil)
 }
+
+func TestGetResponseWithHttpCache(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var hitNum atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitNum.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"HttpRequest"}`))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	newReq := func() *curl.Response {
+		return cli.NewRequest(&curl.Request{
+			Url:    svr.URL,
+			Method: http.MethodGet,
+		}).SetHttpCache(curl.HttpCacheShared).Submit(context.Background())
+	}
+
+	resp := newReq()
+	if resp.Error != nil || resp.FromCache() {
+		t.Fatalf("first request error:%v, fromCache:%v", resp.Error, resp.FromCache())
+	}
+	resp = newReq()
+	if !resp.FromCache() || hitNum.Load() != 1 {
+		t.Fatalf("fresh entry not used, hitNum:%d", hitNum.Load())
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	resp = newReq()
+	if !resp.FromCache() || hitNum.Load() != 2 {
+		t.Fatalf("304 not revalidated, hitNum:%d", hitNum.Load())
+	}
+	if resp.StatusCode != http.StatusOK || resp.Response != `{"name":"HttpRequest"}` {
+		t.Fatalf("304 restore error, status:%d, response:%s", resp.StatusCode, resp.Response)
+	}
+}
+
+func TestStaleCache(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var hitNum atomic.Int32
+	var fail atomic.Bool
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hitNum.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=1")
+		_, _ = fmt.Fprintf(w, "v%d", n)
+	}))
+	defer svr.Close()
+
+	ctx := context.Background()
+	for name, httpMode := range map[string]bool{"cache": false, "http": true} {
+		fail.Store(false)
+		cli := curl.NewClient()
+		submit := func(path string, swr, sie time.Duration) *curl.Response {
+			req := cli.NewRequest(&curl.Request{Url: svr.URL + "/" + name + path, Method: http.MethodGet}).
+				SetStaleWhileRevalidate(swr).SetStaleIfError(sie)
+			if httpMode {
+				req.SetHttpCache(curl.HttpCacheShared)
+			} else {
+				req.SetCacheTime(time.Second)
+			}
+			return req.Submit(ctx)
+		}
+		waitUntil(t, func() bool {
+			return submit("/swr", time.Minute, 0).FromCache() && submit("/sie", 0, time.Minute).FromCache()
+		})
+		swrFirst := submit("/swr", time.Minute, 0)
+		sieFirst := submit("/sie", 0, time.Minute)
+		time.Sleep(1100 * time.Millisecond)
+
+		//过期后先返回旧数据，后台刷新
+		before := hitNum.Load()
+		if resp := submit("/swr", time.Minute, 0); !resp.IsStale() || resp.Response != swrFirst.Response {
+			t.Fatalf("%s stale-while-revalidate error:%v, %s", name, resp.Error, resp.Response)
+		}
+		waitUntil(t, func() bool {
+			resp := submit("/swr", time.Minute, 0)
+			return !resp.IsStale() && resp.FromCache() && resp.Response != swrFirst.Response
+		})
+		if hitNum.Load() != before+1 {
+			t.Fatalf("%s refresh num:%d", name, hitNum.Load()-before)
+		}
+
+		//后台刷新不能与调用方共享header，调用方继续修改请求不会有数据竞争
+		staleReq := cli.NewRequest(&curl.Request{Url: svr.URL + "/" + name + "/swr-copy", Method: http.MethodGet}).
+			SetHeaders(map[string]string{"X-Trace": "0"}).SetStaleWhileRevalidate(time.Minute)
+		if httpMode {
+			staleReq.SetHttpCache(curl.HttpCacheShared)
+		} else {
+			staleReq.SetCacheTime(time.Second)
+		}
+		waitUntil(t, func() bool { return staleReq.Submit(ctx).FromCache() })
+		time.Sleep(1100 * time.Millisecond)
+		staleReq.Submit(ctx)
+		for i := 0; i < 100; i++ {
+			staleReq.SetHeaders(map[string]string{"X-Trace": strconv.Itoa(i)})
+		}
+
+		//请求失败时返回旧数据
+		fail.Store(true)
+		resp := submit("/sie", 0, time.Minute)
+		if !resp.IsStale() || resp.StaleError() == nil || resp.Response != sieFirst.Response {
+			t.Fatalf("%s stale-if-error error:%v, %s", name, resp.StaleError(), resp.Response)
+		}
+		//没有设置时返回实际的错误
+		if resp = submit("/sie", 0, 0); resp.IsStale() || resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("%s stale should not be returned:%d", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestGetResponseWithSingleFlight(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var hitNum int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hitNum, 1)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"name":"HttpRequest"}`))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient().WithSingleFlight(true)
+	respList := make([]*curl.Response, 10)
+	wg := sync.WaitGroup{}
+	for i := range respList {
+		req := cli.NewRequest(&curl.Request{
+			Url:    svr.URL,
+			Data:   data,
+			Method: http.MethodGet,
+		})
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			respList[i] = req.Submit(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&hitNum) != 1 {
+		t.Fatalf("request not coalesced, hitNum:%d", hitNum)
+	}
+	for i, resp := range respList {
+		if resp.Error != nil || resp.Response != `{"name":"HttpRequest"}` {
+			t.Fatalf("resp %d error:%v, response:%s", i, resp.Error, resp.Response)
+		}
+		if i > 0 && resp == respList[0] {
+			t.Fatalf("resp %d shares the same object", i)
+		}
+	}
+
+	//写操作不能合并
+	atomic.StoreInt32(&hitNum, 0)
+	for i := range respList {
+		req := cli.NewRequest(&curl.Request{
+			Url:    svr.URL,
+			Data:   data,
+			Method: http.MethodPost,
+		})
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			respList[i] = req.Submit(context.Background())
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&hitNum); n != int32(len(respList)) {
+		t.Fatalf("post should not be coalesced, hitNum:%d", n)
+	}
+}
+
+func TestSingleFlightKeyAndTimeout(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	type tenantKey struct{}
+	var hitNum atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitNum.Add(1)
+		if r.URL.Path == "/hang" {
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient().WithSingleFlight(true).
+		WithCacheKeyFunc(curl.NewCacheKeyBuilder().NamespaceFromCtx(tenantKey{}).Build())
+
+	//不同租户的请求不能合并
+	tenants := []string{"a", "b", "a"}
+	keys := make([]string, len(tenants))
+	wg := sync.WaitGroup{}
+	for i, tenant := range tenants {
+		req := cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodGet})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := req.Submit(context.WithValue(context.Background(), tenantKey{}, tenant))
+			if resp.Error != nil {
+				t.Errorf("tenant %s error:%v", tenant, resp.Error)
+			}
+			keys[i] = resp.CacheKey
+		}()
+	}
+	wg.Wait()
+	if hitNum.Load() != 2 {
+		t.Fatalf("tenants coalesced, hitNum:%d", hitNum.Load())
+	}
+	if !strings.HasPrefix(keys[0], "a:") || !strings.HasPrefix(keys[1], "b:") || keys[0] != keys[2] {
+		t.Fatalf("cache key error:%v", keys)
+	}
+
+	//上游一直不返回时，合并的请求按 SetTimeout 结束
+	start := time.Now()
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL + "/hang", Method: http.MethodGet}).
+		SetTimeout(100 * time.Millisecond).Submit(context.Background())
+	if !errors.Is(resp.Error, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Fatalf("leader not bounded:%v, cost:%v", resp.Error, time.Since(start))
+	}
+}
+
+func TestResponseCacheRoundTrip(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Custom", "v1")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer svr.Close()
+
+	store := cache.NewMemGoCache[string](time.Minute, time.Minute)
+	cli := curl.NewClient().WithCache(store)
+	ctx := context.Background()
+	newReq := func(path string) *curl.Response {
+		return cli.NewRequest(&curl.Request{
+			Url:    svr.URL + path,
+			Data:   map[string]any{"password": "secret-data"},
+			Method: http.MethodPost,
+			Header: http.Header{"Authorization": {"Bearer secret-token"}, "Cookie": {"sid=secret-cookie"}},
+		}).SetCache(time.Minute, func(resp *curl.Response) bool { return true }).Submit(ctx)
+	}
+
+	first := newReq("/new?token=secret-query")
+	waitUntil(t, func() bool { return newReq("/new?token=secret-query").FromCache() })
+	raw, _ := cache.NsGet[string](ctx, store, "comm-request", first.CacheKey)
+	for _, secret := range []string{"secret-token", "secret-cookie", "secret-data", "secret-query", "session=abc"} {
+		if strings.Contains(raw, secret) {
+			t.Fatalf("cache entry contains %s: %s", secret, raw)
+		}
+	}
+	resp := newReq("/new?token=secret-query")
+	if resp.StatusCode != http.StatusCreated || resp.Response != `{"id":1}` || resp.Header.Get("X-Custom") != "v1" ||
+		resp.Header.Get("Set-Cookie") != "" || resp.Error != nil {
+		t.Fatalf("restore error, status:%d, header:%v, error:%v", resp.StatusCode, resp.Header, resp.Error)
+	}
+	//请求信息只恢复method、url以及缓存key，不包含header和请求数据
+	if resp.Request == nil || resp.Request.Method != http.MethodPost || resp.Request.Url != svr.URL+"/new" ||
+		resp.Request.Header != nil || resp.Request.Data != nil || resp.CacheKey != first.CacheKey {
+		t.Fatalf("restore request error: %+v, cacheKey:%s", resp.Request, resp.CacheKey)
+	}
+
+	//旧版本的缓存只有 createTime 和 response，按200返回
+	old := newReq("/old")
+	waitUntil(t, func() bool { return newReq("/old").FromCache() })
+	oldEntry := `{"createTime":"` + time.Now().Format(time.RFC3339Nano) + `","response":"{\"id\":0}","request":{"url":"x"}}`
+	_, _ = cache.NsSet[string](ctx, store, "comm-request", old.CacheKey, oldEntry, time.Minute)
+	resp = newReq("/old")
+	if !resp.FromCache() || resp.StatusCode != http.StatusOK || resp.Response != `{"id":0}` || resp.Error != nil {
+		t.Fatalf("old entry error, status:%d, response:%s", resp.StatusCode, resp.Response)
+	}
+}
+
+func TestCacheKeyBuilder(t *testing.T) {
+	type tenantKey struct{}
+	ctx := context.Background()
+	keyFunc := curl.NewCacheKeyBuilder().IgnoreFields("nonce").
+		IncludeHeaders("X-Tenant", "X-Request-Id").ExcludeHeaders("X-Request-Id").
+		NamespaceFromCtx(tenantKey{}).Build()
+	newKey := func(ctx context.Context, url string, data any, header http.Header) string {
+		return keyFunc(ctx, &curl.Request{Url: url, Data: data, Method: http.MethodPost, Header: header})
+	}
+
+	//大整数不能因为精度丢失而相同
+	if newKey(ctx, "http://a/x", `{"id":9007199254740993,"nonce":1}`, nil) ==
+		newKey(ctx, "http://a/x", `{"id":9007199254740992,"nonce":1}`, nil) {
+		t.Fatal("big ids share one key")
+	}
+	if newKey(ctx, "http://a/x?nonce=1&a=1", `{"id":1,"nonce":1}`, nil) !=
+		newKey(ctx, "http://a/x?a=1&nonce=2", `{"id":1,"nonce":2}`, nil) {
+		t.Fatal("ignored fields changed key")
+	}
+	if newKey(ctx, "http://a/x", "id=1&nonce=1", nil) != newKey(ctx, "http://a/x", "id=1&nonce=2", nil) {
+		t.Fatal("ignored form fields changed key")
+	}
+
+	h1 := http.Header{"X-Tenant": {"t1"}, "X-Request-Id": {"1"}, "X-Trace": {"a"}}
+	h2 := http.Header{"X-Tenant": {"t1"}, "X-Request-Id": {"2"}, "X-Trace": {"b"}}
+	h3 := http.Header{"X-Tenant": {"t2"}}
+	if newKey(ctx, "http://a/x", "", h1) != newKey(ctx, "http://a/x", "", h2) {
+		t.Fatal("excluded or not included headers changed key")
+	}
+	if newKey(ctx, "http://a/x", "", h1) == newKey(ctx, "http://a/x", "", h3) {
+		t.Fatal("included header not used")
+	}
+
+	nsKey := newKey(context.WithValue(ctx, tenantKey{}, "t1"), "http://a/x", "", nil)
+	if !strings.HasPrefix(nsKey, "t1:") || nsKey == newKey(context.WithValue(ctx, tenantKey{}, "t2"), "http://a/x", "", nil) {
+		t.Fatalf("namespace error:%s", nsKey)
+	}
+}
+
+func TestInvalidateCacheByTags(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var hitNum atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitNum.Add(1)
+		_, _ = w.Write([]byte(`{"id":42}`))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient().WithCacheUrlIndex(true)
+	getUser := func() *curl.Response {
+		return cli.NewRequest(&curl.Request{
+			Url:    svr.URL + "/users/42",
+			Method: http.MethodGet,
+		}).SetCacheTime(time.Minute).SetCacheTags("user:42").Submit(context.Background())
+	}
+
+	_ = getUser()
+	waitUntil(t, func() bool { return getUser().FromCache() })
+
+	_ = cli.NewRequest(&curl.Request{
+		Url:    svr.URL + "/users/42",
+		Data:   map[string]any{"name": "new"},
+		Method: http.MethodPut,
+	}).SetInvalidateTags("user:42").Submit(context.Background())
+	if resp := getUser(); resp.FromCache() {
+		t.Fatalf("cache not invalidated by tag")
+	}
+
+	waitUntil(t, func() bool { return getUser().FromCache() })
+	if err := cli.InvalidateCacheByPrefix(context.Background(), svr.URL+"/users"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := getUser(); resp.FromCache() {
+		t.Fatalf("cache not invalidated by prefix, hitNum:%d", hitNum.Load())
+	}
+
+	//使用请求自己的缓存key方法删除
+	keyFunc := func(ctx context.Context, req *curl.Request) string { return "user-self" }
+	newReq := func() *curl.Response {
+		return cli.NewRequest(&curl.Request{Url: svr.URL + "/self", Method: http.MethodGet}).
+			SetCacheKeyFunc(keyFunc).SetCacheTime(time.Minute).Submit(context.Background())
+	}
+	_ = newReq()
+	waitUntil(t, func() bool { return newReq().FromCache() })
+	err := cli.NewRequest(&curl.Request{Url: svr.URL + "/self", Method: http.MethodGet}).
+		SetCacheKeyFunc(keyFunc).InvalidateCache(context.Background())
+	if err != nil || newReq().FromCache() {
+		t.Fatalf("cache not invalidated by key func:%v", err)
+	}
+}
+
+// submitter 请求，先在同一个goroutine中生成，再并发提交
+type submitter interface {
+	Submit(ctx context.Context) *curl.Response
+}
+
+func TestInvalidateCacheByTagsConcurrent(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer svr.Close()
+
+	mr := miniredis.RunT(t)
+	for _, store := range []cache.CommCache[string]{
+		curl.NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "tag:"),
+		cache.NewMemGoCache[string](time.Minute, time.Minute),
+	} {
+		cli := curl.NewClient().WithCache(store).WithCacheUrlIndex(true)
+		build := func(i int) submitter {
+			return cli.NewRequest(&curl.Request{Url: fmt.Sprintf("%s/items/%d", svr.URL, i), Method: http.MethodGet}).
+				SetCacheTime(time.Minute).SetCacheTags("items")
+		}
+		//只读取缓存，没有缓存时也不写入，避免检查时产生新的缓存
+		cached := func(i int) bool {
+			return cli.NewRequest(&curl.Request{Url: fmt.Sprintf("%s/items/%d", svr.URL, i), Method: http.MethodGet}).
+				SetCacheTime(time.Minute).SetCacheCheckFunc(func(resp *curl.Response) bool { return false }).
+				Submit(context.Background()).FromCache()
+		}
+
+		//并发写入tag索引时不能丢失
+		const num = 50
+		wave := func() {
+			reqList := make([]submitter, num)
+			for i := range reqList {
+				reqList[i] = build(i)
+			}
+			wg := sync.WaitGroup{}
+			for _, req := range reqList {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_ = req.Submit(context.Background())
+				}()
+			}
+			wg.Wait()
+			for i := 0; i < num; i++ {
+				waitUntil(t, func() bool { return cached(i) })
+			}
+		}
+		wave()
+		if err := cli.InvalidateCacheByTags(context.Background(), "items"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < num; i++ {
+			if cached(i) {
+				t.Fatalf("%T cache %d not invalidated", store, i)
+			}
+		}
+		wave()
+		if err := cli.InvalidateCacheByPrefix(context.Background(), svr.URL+"/items"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < num; i++ {
+			if cached(i) {
+				t.Fatalf("%T cache %d not invalidated by prefix", store, i)
+			}
+		}
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	ctx := context.Background()
+	value := strings.Repeat("x", 100)
+
+	//L1按字节数淘汰
+	l1Only := curl.NewTieredCache(nil, 250, time.Minute)
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = l1Only.Set(ctx, key, value, time.Minute)
+	}
+	if val, _ := l1Only.Get(ctx, "a"); val != "" {
+		t.Fatal("l1 not evicted by bytes")
+	}
+	if val, _ := l1Only.Get(ctx, "c"); val != value {
+		t.Fatal("latest entry evicted")
+	}
+
+	//读写穿透
+	mr := miniredis.RunT(t)
+	rc := curl.NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "tiered:")
+	tc := curl.NewTieredCache(rc, 0, time.Minute)
+	_, _ = tc.Set(ctx, "w", "1", time.Minute)
+	if val, _ := rc.Get(ctx, "w"); val != "1" {
+		t.Fatal("not written through to l2")
+	}
+	_, _ = rc.Set(ctx, "r", "2", time.Minute)
+	for i := 0; i < 2; i++ {
+		if val, _ := tc.Get(ctx, "r"); val != "2" {
+			t.Fatal("not read through from l2")
+		}
+	}
+	if stats := tc.Stats(); stats.L2Hits != 1 || stats.L1Hits != 1 {
+		t.Fatalf("stats error:%+v", stats)
+	}
+
+	//L1不能比L2晚过期
+	_, _ = rc.Set(ctx, "ttl", "3", 100*time.Millisecond)
+	if val, _ := tc.Get(ctx, "ttl"); val != "3" {
+		t.Fatal("ttl entry not read")
+	}
+	time.Sleep(150 * time.Millisecond)
+	mr.FastForward(150 * time.Millisecond)
+	if val, _ := tc.Get(ctx, "ttl"); val != "" {
+		t.Fatal("l1 outlived l2")
+	}
+
+	//不存在时返回错误的L2算作没有命中
+	memTc := curl.NewTieredCache(cache.NewMemGoCache[string](time.Minute, time.Minute), 0, time.Minute)
+	if val, err := memTc.Get(ctx, "none"); val != "" || err != nil {
+		t.Fatalf("miss error:%v", err)
+	}
+	if stats := memTc.Stats(); stats.L2Misses != 1 || stats.L2Errors != 0 {
+		t.Fatalf("miss stats error:%+v", stats)
+	}
+	downTc := curl.NewTieredCache(curl.NewRedisCache(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}), ""), 0, time.Minute)
+	if _, err := downTc.Get(ctx, "none"); err == nil {
+		t.Fatal("l2 error expected")
+	}
+	if stats := downTc.Stats(); stats.L2Errors != 1 || stats.L2Misses != 0 {
+		t.Fatalf("error stats error:%+v", stats)
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	mr := miniredis.RunT(t)
+	rc := curl.NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "test:")
+	ctx := context.Background()
+
+	if _, err := rc.Set(ctx, "a", "1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := rc.Get(ctx, "a"); err != nil || val != "1" {
+		t.Fatalf("get error:%v, val:%s", err, val)
+	}
+	if !mr.Exists("test:a") || mr.TTL("test:a") != time.Minute {
+		t.Fatalf("prefix or ttl not passed through, ttl:%v", mr.TTL("test:a"))
+	}
+	if err := rc.MSet(ctx, map[string]string{"b": "2", "c": "3"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := rc.MGet(ctx, "a", "b", "none"); err != nil || len(m) != 2 || m["b"] != "2" {
+		t.Fatalf("mget error:%v, data:%v", err, m)
+	}
+
+	mr.Close()
+	if _, err := rc.Get(ctx, "a"); err == nil {
+		t.Fatalf("closed redis should return error")
+	}
+	if _, err := rc.Get(ctx, "a"); !errors.Is(err, curl.ErrRedisUnavailable) {
+		t.Fatalf("redis should be degraded, error:%v", err)
+	}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name":"HttpRequest"}`))
+	}))
+	defer svr.Close()
+	resp := curl.NewClient().WithCache(rc).NewRequest(&curl.Request{
+		Url:    svr.URL,
+		Method: http.MethodGet,
+	}).SetCacheTime(time.Minute).Submit(ctx)
+	if resp.Error != nil || resp.Response == "" {
+		t.Fatalf("request should not fail when redis is down, error:%v", resp.Error)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	dc, err := curl.NewDiskCache(dir, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//过期时间
+	_, _ = dc.Set(ctx, "ttl", "v", 50*time.Millisecond)
+	if val, _ := dc.Get(ctx, "ttl"); val != "v" {
+		t.Fatalf("get error:%s", val)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if val, _ := dc.Get(ctx, "ttl"); val != "" {
+		t.Fatalf("expired entry returned:%s", val)
+	}
+
+	//超过最大字节数时删除最久没有访问的
+	value := strings.Repeat("x", 100)
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = dc.Set(ctx, key, value, time.Minute)
+	}
+	if val, _ := dc.Get(ctx, "a"); val != "" || dc.Size() > 300 {
+		t.Fatalf("lru not evicted, size:%d", dc.Size())
+	}
+	if val, _ := dc.Get(ctx, "c"); val != value {
+		t.Fatal("latest entry evicted")
+	}
+
+	//崩溃时留下的临时文件在重启时删除，已有的数据依然可用
+	tmpFile := filepath.Join(dir, "ab", "ab-123.tmp")
+	_ = os.MkdirAll(filepath.Dir(tmpFile), 0o755)
+	_ = os.WriteFile(tmpFile, []byte("partial"), 0o644)
+	_, _ = dc.Set(ctx, "short", "v", 50*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+
+	dc, err = curl.NewDiskCache(dir, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(tmpFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("temp file not removed:%v", err)
+	}
+	if val, _ := dc.Get(ctx, "c"); val != value {
+		t.Fatal("entry lost after reload")
+	}
+	if val, _ := dc.Get(ctx, "short"); val != "" {
+		t.Fatal("expired entry loaded")
+	}
+
+	//返回内容流式写入磁盘缓存
+	body := strings.Repeat(`{"name":"HttpRequest"}`, 1000)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer svr.Close()
+
+	dc, _ = curl.NewDiskCache(t.TempDir(), 0)
+	cli := curl.NewClient().WithCache(dc)
+	newReq := func() *curl.Response {
+		return cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodGet}).
+			SetCacheTime(time.Minute).Submit(ctx)
+	}
+	first := newReq()
+	waitUntil(t, func() bool { return newReq().FromCache() })
+	rc, err := dc.GetReader(ctx, "comm-request:"+first.CacheKey)
+	if err != nil || rc == nil {
+		t.Fatalf("stream entry not found:%v", err)
+	}
+	raw, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if !strings.HasSuffix(string(raw), "\n"+body) {
+		t.Fatal("body not written as raw stream")
+	}
+	if resp := newReq(); resp.Response != body || resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream entry restore error, status:%d", resp.StatusCode)
+	}
+	if err = cli.InvalidateCache(ctx, &curl.Request{Url: svr.URL, Method: http.MethodGet}); err != nil || newReq().FromCache() {
+		t.Fatalf("stream entry not invalidated:%v", err)
+	}
+
+	//http语义缓存以及设置了编码方式时也流式写入，写入的是转换字符集之前的原始内容
+	text := strings.Repeat("中文内容", 500)
+	gbkText, _ := simplifiedchinese.GBK.NewEncoder().String(text)
+	gbkSvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=gbk")
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(gbkText))
+	}))
+	defer gbkSvr.Close()
+	gzipCodec := curl.NewGzipCacheCodec(0)
+	for name, codecs := range map[string][]curl.CacheCodec{"plain": nil, "gzip": {gzipCodec}} {
+		for _, httpMode := range []bool{false, true} {
+			dc, _ = curl.NewDiskCache(t.TempDir(), 0)
+			cli = curl.NewClient().WithCache(dc).WithCacheCodec(codecs...)
+			newReq = func() *curl.Response {
+				req := cli.NewRequest(&curl.Request{Url: gbkSvr.URL, Method: http.MethodGet})
+				if httpMode {
+					return req.SetHttpCache(curl.HttpCachePrivate).Submit(ctx)
+				}
+				return req.SetCacheTime(time.Minute).Submit(ctx)
+			}
+			first = newReq()
+			waitUntil(t, func() bool { return newReq().FromCache() })
+			key := "comm-request:" + first.CacheKey
+			if httpMode {
+				key = "comm-request-http:" + first.CacheKey
+			}
+			rc, err = dc.GetReader(ctx, key)
+			if err != nil || rc == nil {
+				t.Fatalf("%s http:%v stream entry not found:%v", name, httpMode, err)
+			}
+			raw, _ = io.ReadAll(rc)
+			_ = rc.Close()
+			if codecs == nil && !strings.HasSuffix(string(raw), "\n"+gbkText) {
+				t.Fatalf("%s http:%v body not written as raw stream", name, httpMode)
+			}
+			if codecs != nil && (!strings.HasPrefix(string(raw), "#cs:gzip:") || strings.Contains(string(raw), gbkText)) {
+				t.Fatalf("%s http:%v body not encoded", name, httpMode)
+			}
+			resp := newReq()
+			if !resp.FromCache() || resp.Response != text || string(resp.RawBody()) != gbkText {
+				t.Fatalf("%s http:%v stream entry restore error:%v", name, httpMode, resp.Error)
+			}
+		}
+	}
+}
+
+func TestPrefetchAndRefreshAhead(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var hitNum atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitNum.Add(1)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	ctx := context.Background()
+	gen := cli.NewRequest(&curl.Request{Url: svr.URL + "/hot", Method: http.MethodGet}).SetCacheTime(time.Minute)
+	if err := cli.Prefetch(ctx, gen); err != nil || hitNum.Load() != 1 {
+		t.Fatalf("prefetch error:%v, hitNum:%d", err, hitNum.Load())
+	}
+	//预热以后，同一个请求对象依然读取缓存
+	if resp := gen.Submit(ctx); !resp.FromCache() || hitNum.Load() != 1 {
+		t.Fatalf("prefetched request not read from cache, hitNum:%d", hitNum.Load())
+	}
+	noCache := cli.NewRequest(&curl.Request{Url: svr.URL + "/none", Method: http.MethodGet})
+	if err := cli.Prefetch(ctx, noCache); err == nil {
+		t.Fatal("cache time error expected")
+	}
+
+	//缓存剩余时间小于设置的百分比时，提前在后台刷新
+	newReq := func() *curl.Response {
+		return cli.NewRequest(&curl.Request{Url: svr.URL + "/ahead", Method: http.MethodGet}).
+			SetCacheTime(300 * time.Millisecond).SetRefreshAhead(50).Submit(ctx)
+	}
+	_ = newReq()
+	waitUntil(t, func() bool { return newReq().FromCache() })
+	before := hitNum.Load()
+	if resp := newReq(); !resp.FromCache() || hitNum.Load() != before {
+		t.Fatal("fresh entry refreshed too early")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if resp := newReq(); !resp.FromCache() {
+		t.Fatal("refresh ahead should return cached data")
+	}
+	waitUntil(t, func() bool { return hitNum.Load() == before+1 })
+}
+
+func TestNegativeCache(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var hitNum atomic.Int32
+	var fail atomic.Bool
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitNum.Add(1)
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/slow":
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"id":1}`))
+		case fail.Load():
+			//直接关闭连接，客户端得到没有状态码的错误
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		default:
+			_, _ = w.Write([]byte(`{"id":1}`))
+		}
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	submit := func(ctx context.Context, path string) *curl.Response {
+		return cli.NewRequest(&curl.Request{Url: svr.URL + path, Method: http.MethodGet}).
+			SetCacheTime(200*time.Millisecond).SetStaleWhileRevalidate(time.Minute).
+			SetNegativeCache(time.Minute, nil).SetErrorCache(time.Minute).Submit(ctx)
+	}
+	ctx := context.Background()
+
+	_ = submit(ctx, "/missing")
+	waitUntil(t, func() bool { return submit(ctx, "/missing").FromCache() })
+	if resp := submit(ctx, "/missing"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("not found cache status:%d", resp.StatusCode)
+	}
+
+	//后台刷新失败时不能覆盖还可以使用的缓存
+	_ = submit(ctx, "/data")
+	waitUntil(t, func() bool { return submit(ctx, "/data").FromCache() })
+	time.Sleep(250 * time.Millisecond)
+	fail.Store(true)
+	before := hitNum.Load()
+	if resp := submit(ctx, "/data"); !resp.IsStale() {
+		t.Fatalf("stale data not returned:%v", resp.Error)
+	}
+	waitUntil(t, func() bool { return hitNum.Load() > before })
+	time.Sleep(100 * time.Millisecond)
+	if resp := submit(ctx, "/data"); resp.Error != nil || resp.Response != `{"id":1}` {
+		t.Fatalf("refresh error overwrote cache:%v", resp.Error)
+	}
+
+	//请求错误的缓存，恢复后可以通过 ErrCachedError 判断
+	first := submit(ctx, "/error")
+	if first.Error == nil {
+		t.Fatal("request error expected")
+	}
+	waitUntil(t, func() bool { return submit(ctx, "/error").FromCache() })
+	if resp := submit(ctx, "/error"); !errors.Is(resp.Error, curl.ErrCachedError) || resp.Error.Error() != first.Error.Error() {
+		t.Fatalf("cached error:%v", resp.Error)
+	}
+
+	//调用方自己超时的请求不缓存
+	fail.Store(false)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	slowReq := func(ctx context.Context) *curl.Response {
+		return cli.NewRequest(&curl.Request{Url: svr.URL + "/slow", Method: http.MethodGet}).
+			SetSingleFlight(true).SetErrorCache(time.Minute).Submit(ctx)
+	}
+	if resp := slowReq(timeoutCtx); !errors.Is(resp.Error, context.DeadlineExceeded) {
+		t.Fatalf("deadline error expected:%v", resp.Error)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if resp := slowReq(ctx); resp.FromCache() || resp.Error != nil {
+		t.Fatalf("caller timeout cached:%v", resp.Error)
+	}
+}
+
+func TestCacheCodec(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	body := strings.Repeat(`{"name":"HttpRequest"}`, 100)
+	hitNum := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitNum++
+		_, _ = w.Write([]byte(body))
+	}))
+	defer svr.Close()
+
+	memCache := cache.NewMemGoCache[string](time.Minute, time.Minute)
+	oldClient := curl.NewClient().WithCache(memCache)
+	aesCodec, err := curl.NewAesGcmCacheCodec("k2", map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("fedcba9876543210"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newClient := curl.NewClient().WithCache(memCache).WithCacheCodec(curl.NewGzipCacheCodec(0), aesCodec)
+
+	newReq := func(u string) *curl.Request {
+		return &curl.Request{Url: u, Method: http.MethodGet}
+	}
+	//明文的旧数据可以被新的client读取
+	_ = oldClient.NewRequest(newReq(svr.URL + "/old")).SetCacheTime(time.Minute).Submit(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	if resp := newClient.NewRequest(newReq(svr.URL + "/old")).SetCacheTime(time.Minute).Submit(context.Background()); !resp.FromCache() || resp.Response != body {
+		t.Fatalf("plaintext entry not readable")
+	}
+
+	_ = newClient.NewRequest(newReq(svr.URL + "/new")).SetCacheTime(time.Minute).Submit(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	if resp := newClient.NewRequest(newReq(svr.URL + "/new")).SetCacheTime(time.Minute).Submit(context.Background()); !resp.FromCache() || resp.Response != body {
+		t.Fatalf("encoded entry not readable")
+	}
+	if resp := oldClient.NewRequest(newReq(svr.URL + "/new")).SetCacheTime(time.Minute).Submit(context.Background()); resp.FromCache() {
+		t.Fatalf("encoded entry should not be readable without codec")
+	}
+	if hitNum != 3 {
+		t.Fatalf("hitNum error:%d", hitNum)
+	}
+}
+
+func TestClientDefault(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.EscapedPath() + "?" + r.URL.RawQuery + "|" + r.Header.Get("X-App") + "|" + r.Header.Get("User-Agent")))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient().WithBaseURL(svr.URL + "/v1/").
+		WithDefaultHeaders(map[string]string{"X-App": "default"}).
+		WithDefaultQuery(url.Values{"token": {"default"}}).
+		WithUserAgent("default-agent")
+
+	//路径拼接
+	pathList := map[string]string{
+		"users/1":                   "/v1/users/1?token=default",
+		"/users/1?a=1":              "/v1/users/1?a=1&token=default",
+		"users?next=http://a.com/b": "/v1/users?next=http%3A%2F%2Fa.com%2Fb&token=default",
+		"a%2Fb":                     "/v1/a%2Fb?token=default",
+		svr.URL + "/abs":            "/abs?token=default",
+		strings.TrimPrefix(svr.URL, "http:") + "/scheme": "/scheme?token=default",
+	}
+	for reqUrl, want := range pathList {
+		resp := cli.NewRequest(&curl.Request{Url: reqUrl}).Submit(context.Background())
+		if resp.Error != nil || !strings.HasPrefix(resp.Response, want+"|") {
+			t.Fatalf("base url %s error:%v, %s", reqUrl, resp.Error, resp.Response)
+		}
+	}
+
+	//默认设置
+	resp := cli.NewRequest(&curl.Request{Url: "users"}).Submit(context.Background())
+	if resp.Response != "/v1/users?token=default|default|default-agent" {
+		t.Fatalf("default error:%s", resp.Response)
+	}
+
+	//请求中的设置优先，调用方的header不被修改
+	header := http.Header{"X-App": {"req"}, "User-Agent": {"req-agent"}}
+	resp = cli.NewRequest(&curl.Request{Url: "users?token=req", Header: header}).Submit(context.Background())
+	if resp.Response != "/v1/users?token=req|req|req-agent" {
+		t.Fatalf("override error:%s", resp.Response)
+	}
+	header = http.Header{"X-Trace": {"1"}}
+	resp = cli.NewRequest(&curl.Request{Url: "users", Method: http.MethodGet, Header: header, Data: map[string]string{"token": "data"}}).Submit(context.Background())
+	if resp.Response != "/v1/users?token=data|default|default-agent" {
+		t.Fatalf("data override error:%s", resp.Response)
+	}
+	if len(header) != 1 || header.Get("X-Trace") != "1" {
+		t.Fatalf("caller header changed:%v", header)
+	}
+}
+
+func TestPathParams(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var path, query string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.EscapedPath(), r.URL.RawQuery
+	}))
+	defer svr.Close()
+
+	type userId int64
+	type orderStatus string
+	cli := curl.NewClient()
+	tpl := svr.URL + "/users/{id}/orders/{name}?status={status}"
+	resp := cli.NewRequest(&curl.Request{Url: tpl, Method: http.MethodGet}).
+		SetPathParams(map[string]any{"id": userId(12), "name": "a/b c", "status": orderStatus("a&b=c")}).Submit(context.Background())
+	if resp.Error != nil || path != "/users/12/orders/a%2Fb%20c" || query != "status=a%26b%3Dc" || resp.UrlTemplate != tpl {
+		t.Fatalf("path params error:%v, %s, %s, %s", resp.Error, path, query, resp.UrlTemplate)
+	}
+
+	//不是 {name} 格式的大括号原样保留
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + `/items?filter={"a":1}`, Method: http.MethodGet}).Submit(context.Background())
+	if resp.Error != nil || path != "/items" || query != `filter={"a":1}` || resp.UrlTemplate != "" {
+		t.Fatalf("literal braces error:%v, %s, %s", resp.Error, path, query)
+	}
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + `/users/{id}?filter={"a":1}`, Method: http.MethodGet}).
+		SetPathParams(map[string]any{"id": 1}).Submit(context.Background())
+	if resp.Error != nil || path != "/users/1" || query != `filter={"a":1}` {
+		t.Fatalf("literal braces with params error:%v, %s, %s", resp.Error, path, query)
+	}
+
+	//缺少参数、多余参数、没有设置参数时都需要返回错误
+	path = ""
+	errList := map[string]*curl.Response{
+		"missing": cli.NewRequest(&curl.Request{Url: tpl}).SetPathParams(map[string]any{"id": 1, "name": "a"}).Submit(context.Background()),
+		"unused":  cli.NewRequest(&curl.Request{Url: tpl}).SetPathParams(map[string]any{"id": 1, "name": "a", "status": 1, "other": 2}).Submit(context.Background()),
+		"unset":   cli.NewRequest(&curl.Request{Url: tpl}).Submit(context.Background()),
+		"type":    cli.NewRequest(&curl.Request{Url: tpl}).SetPathParams(map[string]any{"id": []int{1}, "name": "a", "status": 1}).Submit(context.Background()),
+	}
+	for name, resp := range errList {
+		if resp.Error == nil {
+			t.Fatalf("%s should return error", name)
+		}
+	}
+	if path != "" {
+		t.Fatalf("request should not be sent:%s", path)
+	}
+}
+
+func TestQueryStyle(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var rawQuery string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer svr.Close()
+
+	type filter struct {
+		Ids  []int64           `url:"ids"`
+		Name string            `url:"name,omitempty"`
+		Sort map[string]string `url:"sort"`
+	}
+	data := filter{Ids: []int64{9007199254740993, 2}, Sort: map[string]string{"age": "desc"}}
+
+	cli := curl.NewClient()
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodGet, Data: data}).
+		SetQueryStyle(curl.QueryArrayComma, curl.QueryNestDot).Submit(context.Background())
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if rawQuery != "ids=9007199254740993%2C2&sort.age=desc" {
+		t.Fatalf("query error:%s", rawQuery)
+	}
+
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodGet, Data: data}).
+		SetQueryStyle(curl.QueryArrayBrackets, curl.QueryNestBracket).Submit(context.Background())
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if rawQuery != "ids%5B%5D=9007199254740993&ids%5B%5D=2&sort%5Bage%5D=desc" {
+		t.Fatalf("query error:%s", rawQuery)
+	}
+
+	//没有设置格式时，数组重复key，嵌套对象使用中括号
+	mapData := map[string]any{"ids": []int64{9007199254740993, 2}, "name": "a b", "sort": map[string]string{"age": "desc"}}
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodGet, Data: mapData}).Submit(context.Background())
+	if resp.Error != nil || rawQuery != "ids=9007199254740993&ids=2&name=a+b&sort%5Bage%5D=desc" {
+		t.Fatalf("default query error:%v, %s", resp.Error, rawQuery)
+	}
+	//不是json对象时直接拼接
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + "?x=1", Method: http.MethodGet, Data: "a=1&b=2"}).Submit(context.Background())
+	if resp.Error != nil || rawQuery != "x=1&a=1&b=2" {
+		t.Fatalf("raw query error:%v, %s", resp.Error, rawQuery)
+	}
+}
+
+func TestBodyEncoder(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var contentType, body string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		contentType, body = r.Header.Get("Content-Type"), string(b)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	data := map[string]interface{}{"name": "a b", "tags": []string{"x", "y"}}
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: data}).SetForm().
+		SetHeaders(map[string]string{"Content-Type": "application/x-www-form-urlencoded"}).Submit(context.Background())
+	if contentType != "application/x-www-form-urlencoded" || body != "name=a+b&tags=x&tags=y" {
+		t.Fatalf("form error:%s, %s", contentType, body)
+	}
+
+	//调用方直接设置的Content-Type不会被修改为json
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded; charset=utf-8"}}
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: data, Header: header}).Submit(context.Background())
+	if contentType != "application/x-www-form-urlencoded; charset=utf-8" || body != "name=a+b&tags=x&tags=y" {
+		t.Fatalf("header form error:%s, %s", contentType, body)
+	}
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: `{"name":"a b"}`, Header: header}).Submit(context.Background())
+	if contentType != "application/x-www-form-urlencoded; charset=utf-8" || body != "name=a+b" {
+		t.Fatalf("header form json string error:%s, %s", contentType, body)
+	}
+
+	type user struct {
+		XMLName struct{} `xml:"user"`
+		Name    string   `xml:"name"`
+	}
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: user{Name: "a"}}).SetXML().Submit(context.Background())
+	if !strings.HasPrefix(contentType, "application/xml") || body != "<user><name>a</name></user>" {
+		t.Fatalf("xml error:%s, %s", contentType, body)
+	}
+
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: data}).SetJSON().
+		SetHeaders(map[string]string{"Content-Type": "application/vnd.api+json"}).Submit(context.Background())
+	if contentType != "application/vnd.api+json" || body != `{"name":"a b","tags":["x","y"]}` {
+		t.Fatalf("json error:%s, %s", contentType, body)
+	}
+
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: []byte(`{"a":1}`)}).SetRaw("text/plain").Submit(context.Background())
+	if contentType != "text/plain" || body != `{"a":1}` {
+		t.Fatalf("raw error:%s, %s", contentType, body)
+	}
+}
+
+// lineCodec 测试用的codec，每行一个值
+type lineCodec struct{}
+
+func (lineCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.Join(v.([]string), "\n")), nil
+}
+
+func (lineCodec) Unmarshal(data []byte, v interface{}) error {
+	list, ok := v.(*[]string)
+	if !ok {
+		return fmt.Errorf("type error: %T", v)
+	}
+	*list = strings.Split(string(data), "\n")
+	return nil
+}
+
+func (lineCodec) Valid(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty data")
+	}
+	return nil
+}
+
+func TestCodecRegistry(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		_, _ = w.Write(b)
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient().WithCodec("text/x-lines", lineCodec{})
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: []string{"a", "b"}}).
+		SetCodec("text/x-lines; charset=utf-8").SetRespMediaType("text/x-lines").Submit(context.Background())
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	list := make([]string, 0)
+	if err := resp.Unmarshal(&list); err != nil || len(list) != 2 || list[1] != "b" {
+		t.Fatalf("unmarshal error:%v, %v", err, list)
+	}
+
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: "not xml"}).
+		SetRaw("text/plain").SetRespMediaType("application/xml").Submit(context.Background())
+	if resp.Error == nil {
+		t.Fatalf("response should not be xml")
+	}
+}
+
+func TestDoTyped(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	type user struct {
+		Id   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	type apiError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":404,"message":"user not found"}`))
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	u, resp, err := curl.DoInto[user, user](context.Background(),
+		cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost}), user{Id: 1, Name: "a"})
+	if err != nil || resp.StatusCode != http.StatusOK || u.Name != "a" {
+		t.Fatalf("DoInto error:%v, %v", err, u)
+	}
+
+	_, _, err = curl.Do[user](context.Background(),
+		cli.NewRequest(&curl.Request{Url: svr.URL + "/missing", Method: http.MethodGet}).SetErrorType(apiError{}))
+	var statusErr *curl.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("status error:%v", err)
+	}
+	if body, ok := curl.ErrorBody[apiError](err); !ok || body.Message != "user not found" {
+		t.Fatalf("error body:%v", body)
+	}
+}
+
+func TestBindApi(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	type user struct {
+		Id   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		b, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, `{"method":%q,"path":%q,"query":%q,"token":%q,"body":%q}`,
+			r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("X-Token"), string(b))
+	}))
+	defer svr.Close()
+
+	type getUserReq struct {
+		Id    int64  `path:"id"`
+		Q     string `query:"q,omitempty"`
+		Token string `header:"X-Token"`
+	}
+	type updateUserReq struct {
+		Id   int64 `path:"id"`
+		User user  `body:"form"`
+	}
+	type echo struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Query  string `json:"query"`
+		Token  string `json:"token"`
+		Body   string `json:"body"`
+	}
+	var api struct {
+		GetUser    func(ctx context.Context, req *getUserReq) (*echo, error)                  `curl:"GET /users/{id}"`
+		UpdateUser func(ctx context.Context, req updateUserReq) (echo, *curl.Response, error) `curl:"PUT /users/{id}"`
+		Ping       func(ctx context.Context) error                                            `curl:"GET /ping"`
+	}
+	if err := curl.NewClient().WithBaseURL(svr.URL + "/v1").BindApi(&api); err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := api.GetUser(context.Background(), &getUserReq{Id: 42, Q: "a b", Token: "t"})
+	if err != nil || ret.Path != "/v1/users/42" || ret.Query != "q=a+b" || ret.Token != "t" {
+		t.Fatalf("GetUser error:%v, %+v", err, ret)
+	}
+	ret2, resp, err := api.UpdateUser(context.Background(), updateUserReq{Id: 1, User: user{Id: 1, Name: "a"}})
+	if err != nil || ret2.Method != http.MethodPut || ret2.Body != "id=1&name=a" || resp.UrlTemplate != "/users/{id}" {
+		t.Fatalf("UpdateUser error:%v, %+v", err, ret2)
+	}
+	if err = api.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHttpMethod(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var method, query, body string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		method, query, body = r.Method, r.URL.RawQuery, string(b)
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodOptions, Data: map[string]string{"a": "1"}}).Submit(context.Background())
+	if resp.Error != nil || method != http.MethodOptions || query != "a=1" || body != "" {
+		t.Fatalf("options error:%v, %s, %s, %s", resp.Error, method, query, body)
+	}
+
+	//标准方法不区分大小写，自定义的方法原样发送
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: "get", Data: map[string]string{"a": "1"}}).Submit(context.Background())
+	if resp.Error != nil || method != http.MethodGet || query != "a=1" {
+		t.Fatalf("lower case get error:%v, %s, %s, %s", resp.Error, method, query, body)
+	}
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: "options", Data: map[string]string{"a": "1"}}).Submit(context.Background())
+	if resp.Error != nil || method != http.MethodOptions || query != "a=1" || body != "" {
+		t.Fatalf("lower case options error:%v, %s, %s, %s", resp.Error, method, query, body)
+	}
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: "purge", Data: "a"}).Submit(context.Background())
+	if resp.Error != nil || method != "purge" || body != "a" {
+		t.Fatalf("custom method error:%v, %s, %s, %s", resp.Error, method, query, body)
+	}
+
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: "PROPFIND", Data: "<propfind/>"}).Submit(context.Background())
+	if resp.Error != nil || method != "PROPFIND" || query != "" || body != "<propfind/>" {
+		t.Fatalf("propfind error:%v, %s, %s, %s", resp.Error, method, query, body)
+	}
+
+	method = ""
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL, Method: "BAD METHOD"}).Submit(context.Background())
+	if resp.Error == nil || method != "" {
+		t.Fatalf("invalid method should return error")
+	}
+}
+
+func TestRequestCompression(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var encoding, body string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		reader := io.Reader(r.Body)
+		if encoding == "gzip" {
+			gr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reader = gr
+		}
+		b, _ := io.ReadAll(reader)
+		body = string(b)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer svr.Close()
+
+	u, _ := url.Parse(svr.URL)
+	cli := curl.NewClient().WithRequestCompression(u.Hostname(), "gzip", 100)
+	bigData := strings.Repeat("a", 1000)
+	retryNum := 0
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: bigData}).
+		SetRetry(2, func(resp *curl.Response) error {
+			retryNum++
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("status:%d", resp.StatusCode)
+			}
+			return nil
+		}).Submit(context.Background())
+	if retryNum != 2 || resp.StatusCode != http.StatusServiceUnavailable || encoding != "gzip" || body != bigData {
+		t.Fatalf("compression error:%d, %d, %s, %d", retryNum, resp.StatusCode, encoding, len(body))
+	}
+
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: "small"}).Submit(context.Background())
+	if encoding != "" || body != "small" {
+		t.Fatalf("small body should not be compressed:%s", encoding)
+	}
+}
+
+type bodyInject struct{}
+
+func (o *bodyInject) BeforeHandler(ctx context.Context, rs *curl.Request, httpReq *http.Request) error {
+	httpReq.Body = io.NopCloser(strings.NewReader("sign"))
+	return nil
+}
+
+func (o *bodyInject) AfterHandler(ctx context.Context, rp *curl.Response) error {
+	return nil
+}
+
+func TestRetryBody(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	var mu sync.Mutex
+	bodyList := make([]string, 0)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodyList = append(bodyList, string(b))
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer svr.Close()
+
+	//第一次请求使用handler修改后的body，重试时才重新取得body
+	cli := curl.NewClient().WithHandler(&bodyInject{})
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodPost, Data: "data"}).
+		SetRetry(2, func(resp *curl.Response) error {
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("status:%d", resp.StatusCode)
+			}
+			return nil
+		}).Submit(context.Background())
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodyList) != 2 || bodyList[0] != "sign" || bodyList[1] == "" {
+		t.Fatalf("retry body error:%v, %v", bodyList, resp.Error)
+	}
+}
+
+func TestResponseDecompression(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	body := strings.Repeat(`{"name":"HttpRequest"}`, 100)
+	var acceptEncoding string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		encoding := r.URL.Query().Get("encoding")
+		w.Header().Set("Content-Encoding", encoding)
+		var zw io.WriteCloser
+		switch encoding {
+		case "br":
+			zw = brotli.NewWriter(w)
+		case "zstd":
+			zw, _ = zstd.NewWriter(w)
+		case "gzip, x-custom":
+			_, _ = w.Write([]byte(body))
+			return
+		default:
+			zw = gzip.NewWriter(w)
+		}
+		_, _ = zw.Write([]byte(body))
+		_ = zw.Close()
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		resp := cli.NewRequest(&curl.Request{Url: svr.URL + "?encoding=" + encoding, Method: http.MethodGet}).
+			SetHeaders(map[string]string{"Accept-Encoding": encoding}).Submit(context.Background())
+		if resp.Error != nil || resp.Response != body || resp.Header.Get("Content-Encoding") != "" {
+			t.Fatalf("%s decode error:%v, %s", encoding, resp.Error, resp.Response)
+		}
+		if resp.DecodedSize() != int64(len(body)) || resp.OriginalSize() >= resp.DecodedSize() {
+			t.Fatalf("%s size error:%d, %d", encoding, resp.OriginalSize(), resp.DecodedSize())
+		}
+	}
+
+	_ = cli.NewRequest(&curl.Request{Url: svr.URL, Method: http.MethodGet}).Submit(context.Background())
+	if !strings.Contains(acceptEncoding, "br") || !strings.Contains(acceptEncoding, "zstd") {
+		t.Fatalf("accept encoding error:%s", acceptEncoding)
+	}
+
+	//不支持的压缩方式，只解压外层支持的部分，Content-Encoding 与内容保持一致
+	for encoding, want := range map[string]string{"x-custom, gzip": "x-custom", "gzip, x-custom": "gzip, x-custom"} {
+		resp := cli.NewRequest(&curl.Request{Url: svr.URL + "?encoding=" + url.QueryEscape(encoding), Method: http.MethodGet}).
+			Submit(context.Background())
+		if resp.Error != nil || resp.Response != body || resp.Header.Get("Content-Encoding") != want {
+			t.Fatalf("%s decode error:%v, %s", encoding, resp.Error, resp.Header.Get("Content-Encoding"))
+		}
+	}
+
+	//解压后超过限制
+	resp := curl.NewClient().WithMaxDecodedSize(100).NewRequest(&curl.Request{Url: svr.URL + "?encoding=gzip", Method: http.MethodGet}).
+		Submit(context.Background())
+	if !errors.Is(resp.Error, curl.ErrDecodedTooLarge) {
+		t.Fatalf("decoded size limit error:%v", resp.Error)
+	}
+}
+
+func TestResponseCharset(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	text := "中文内容"
+	gbkText, _ := simplifiedchinese.GBK.NewEncoder().String(text)
+	big5Text, _ := traditionalchinese.Big5.NewEncoder().String("中文")
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/header":
+			w.Header().Set("Content-Type", "text/plain; charset=gbk")
+			_, _ = w.Write([]byte(gbkText))
+		case "/meta":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><meta charset="gb18030"></head><body>` + gbkText + `</body></html>`))
+		case "/big5":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(big5Text))
+		}
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL + "/header", Method: http.MethodGet}).Submit(context.Background())
+	if resp.Response != text || string(resp.RawBody()) != gbkText {
+		t.Fatalf("header charset error:%s", resp.Response)
+	}
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + "/meta", Method: http.MethodGet}).Submit(context.Background())
+	if !strings.Contains(resp.Response, text) {
+		t.Fatalf("meta charset error:%s", resp.Response)
+	}
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + "/big5", Method: http.MethodGet}).SetRespCharset("big5").Submit(context.Background())
+	if resp.Response != "中文" {
+		t.Fatalf("big5 charset error:%s", resp.Response)
+	}
+}
+
+func TestSOAP(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	gbkResult, _ := simplifiedchinese.GBK.NewEncoder().String("三")
+
+	type addReq struct {
+		XMLName xml.Name `xml:"Add"`
+		A       int      `xml:"a"`
+		B       int      `xml:"b"`
+	}
+	type addResp struct {
+		XMLName xml.Name `xml:"AddResponse"`
+		Result  int      `xml:"result"`
+	}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/v11":
+			if r.Header.Get("SOAPAction") != `"urn:add"` || !strings.Contains(string(body), "<Add><a>1</a><b>2</b></Add>") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			_, _ = w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><AddResponse><result>3</result></AddResponse></soap:Body></soap:Envelope>`))
+		case "/v12":
+			if !strings.Contains(r.Header.Get("Content-Type"), `action="urn:add"`) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>` +
+				`<env:Code><env:Value>env:Sender</env:Value><env:Subcode><env:Value>m:Invalid</env:Value></env:Subcode></env:Code>` +
+				`<env:Reason><env:Text xml:lang="en">bad number</env:Text></env:Reason></env:Fault></env:Body></env:Envelope>`))
+		case "/v11fault":
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+				`<faultcode>soap:Server</faultcode><faultstring>divide by zero</faultstring><detail><code>1001</code></detail>` +
+				`</soap:Fault></soap:Body></soap:Envelope>`))
+		case "/gbk":
+			//字符串的body中带有xml声明，envelope中只能有一个声明
+			if strings.Count(string(body), "<?xml") != 1 || !strings.Contains(string(body), "<soap:Body><Add><a>1</a><b>2</b></Add>") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/xml; charset=gbk")
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="GBK"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+				`<AddResponse><text>` + gbkResult + `</text></AddResponse></soap:Body></soap:Envelope>`))
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`<html><body>bad gateway</body></html>`))
+		}
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	resp := cli.NewRequest(&curl.Request{Url: svr.URL + "/v11"}).
+		SetSOAP(curl.SoapVersion11, "urn:add", addReq{A: 1, B: 2}).Submit(context.Background())
+	ret := new(addResp)
+	if err := resp.UnmarshalSOAPBody(ret); err != nil || ret.Result != 3 {
+		t.Fatalf("soap 1.1 error:%v, %s", err, resp.Response)
+	}
+
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + "/v12"}).
+		SetSOAP(curl.SoapVersion12, "urn:add", addReq{A: 1, B: 2}).Submit(context.Background())
+	var fault *curl.SoapFault
+	if !errors.As(resp.Error, &fault) || fault.Code != "env:Sender" || fault.Subcode != "m:Invalid" || fault.Reason != "bad number" {
+		t.Fatalf("soap 1.2 fault error:%v", resp.Error)
+	}
+
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + "/v11fault"}).
+		SetSOAP(curl.SoapVersion11, "urn:add", addReq{A: 1, B: 2}).Submit(context.Background())
+	fault = nil
+	if !errors.As(resp.Error, &fault) || fault.Version != curl.SoapVersion11 || fault.StatusCode != http.StatusInternalServerError ||
+		fault.Code != "soap:Server" || fault.Reason != "divide by zero" || fault.Detail != "<code>1001</code>" {
+		t.Fatalf("soap 1.1 fault error:%v", resp.Error)
+	}
+
+	//返回gbk编码，xml声明中的encoding不能再次转换
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + "/gbk"}).
+		SetSOAP(curl.SoapVersion11, "urn:add", `<?xml version="1.0" encoding="utf-8"?>`+"\n<Add><a>1</a><b>2</b></Add>").Submit(context.Background())
+	textResp := new(struct {
+		XMLName xml.Name `xml:"AddResponse"`
+		Text    string   `xml:"text"`
+	})
+	if err := resp.UnmarshalSOAPBody(textResp); err != nil || textResp.Text != "三" {
+		t.Fatalf("soap gbk error:%v, %s", err, resp.Response)
+	}
+
+	//返回的不是envelope时需要返回错误
+	resp = cli.NewRequest(&curl.Request{Url: svr.URL + "/html"}).
+		SetSOAP(curl.SoapVersion11, "urn:add", addReq{A: 1, B: 2}).Submit(context.Background())
+	if resp.Error == nil {
+		t.Fatalf("soap non envelope should return error")
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	conf.SetEnv(conf.EnvLoc)
+
+	type user struct {
+		User struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"user"`
+	}
+	var persisted sync.Map
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := new(curl.GraphQLRequest)
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, req)
+		w.Header().Set("Content-Type", "application/json")
+		if pq, ok := req.Extensions["persistedQuery"].(map[string]interface{}); ok {
+			hash := pq["sha256Hash"].(string)
+			if req.Query == "" {
+				if _, ok := persisted.Load(hash); !ok {
+					_, _ = w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound"}]}`))
+					return
+				}
+			} else {
+				persisted.Store(hash, req.Query)
+			}
+		}
+		if req.Variables["id"] == "2" {
+			_, _ = w.Write([]byte(`{"data":{"user":null},"errors":[{"message":"not found","path":["user"],"extensions":{"code":"NOT_FOUND"}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"user":{"id":"1","name":"` + req.OperationName + `"}}}`))
+	}))
+	defer svr.Close()
+
+	cli := curl.NewClient()
+	query := `query GetUser($id: ID!) { user(id: $id) { id name } }`
+	ret := new(user)
+	_, err := cli.GraphQL(context.Background(), svr.URL, &curl.GraphQLRequest{
+		Query: query, OperationName: "GetUser", Variables: map[string]interface{}{"id": "1"},
+	}, ret)
+	if err != nil || ret.User.ID != "1" || ret.User.Name != "GetUser" {
+		t.Fatalf("graphql query error:%v, %+v", err, ret)
+	}
+
+	_, err = cli.GraphQL(context.Background(), svr.URL, &curl.GraphQLRequest{
+		Query: query, Variables: map[string]interface{}{"id": "2"},
+	}, new(user))
+	var gqlErr *curl.GraphQLErrors
+	if !errors.As(err, &gqlErr) || gqlErr.StatusCode != http.StatusOK || gqlErr.Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Fatalf("graphql errors error:%v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		ret = new(user)
+		_, err = cli.GraphQL(context.Background(), svr.URL, &curl.GraphQLRequest{
+			Query: query, Variables: map[string]interface{}{"id": "1"}, PersistedQuery: true,
+		}, ret)
+		if err != nil || ret.User.ID != "1" {
+			t.Fatalf("graphql persisted query error:%v", err)
+		}
+	}
+}
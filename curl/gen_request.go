@@ -3,7 +3,11 @@ package curl
 import (
 	"context"
 	"fmt"
+	"maps"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
 	"time"
 )
 
@@ -24,7 +28,59 @@ type genRequest struct {
 	defaultPrintLogInt int    //0 表示默认，只打印一条，1表示完全打开所有信息，-1 表示完全关闭
 
 	checkCacheFunc func(resp *Response) bool //检查是否需要缓存
+	cacheKeyFunc   CacheKeyFunc              //生成缓存key的方法
+	cacheTags      []string                  //缓存打上的tag，可按tag删除缓存
+	invalidateTags []string                  //请求成功后需要删除的缓存tag
 	cacheTime      time.Duration             //缓存过期时间
+
+	staleWhileRevalidate time.Duration //缓存过期后，这段时间内先返回旧数据，后台刷新
+	staleIfError         time.Duration //缓存过期后，这段时间内请求失败则返回旧数据
+	cacheRefresh         bool          //后台刷新缓存的请求，不读取缓存
+	cacheSync            bool          //同步写入缓存，预热时需要写完才返回
+	refreshAheadPercent  int           //缓存剩余时间小于这个百分比时，提前在后台刷新
+
+	negativeCacheTime time.Duration             //not found结果的缓存时间
+	negativeCheckFunc func(resp *Response) bool //业务上not found的判断方法
+	errorCacheTime    time.Duration             //请求错误的缓存时间
+
+	singleFlight bool //相同缓存key的并发请求是否合并为一次
+
+	httpCacheMode int         //http语义缓存模式，HttpCacheClose 表示不使用
+	condHeader    http.Header //缓存重新验证时附加的请求头
+
+	pathParams  map[string]any //url模板参数
+	urlTemplate string         //替换参数前的url模板，日志中使用
+
+	queryEncoder *queryEncoder //GET、DELETE请求data转为url参数的格式，为空时使用默认方式
+	query        url.Values    //url参数
+
+	bodyContentType string //data的提交格式，使用对应的codec编码，为空时根据data自动判断
+	bodyRaw         bool   //data原样提交
+	respMediaType   string //返回的数据必须能用这个类型的codec解码
+
+	errorType reflect.Type //状态码不是2xx时返回内容的类型
+
+	compress    *compressConfig //请求数据的压缩设置
+	respCharset string          //指定返回内容的字符集
+	soap        *soapConfig     //SOAP请求的设置
+}
+
+// clone 复制一份请求，后台执行时不与调用方共享header、参数等可以修改的数据
+func (g *genRequest) clone() *genRequest {
+	newGen := *g
+	newGen.Header = g.Header.Clone()
+	newGen.condHeader = g.condHeader.Clone()
+	newGen.cookies = slices.Clone(g.cookies)
+	newGen.cacheTags = slices.Clone(g.cacheTags)
+	newGen.invalidateTags = slices.Clone(g.invalidateTags)
+	newGen.pathParams = maps.Clone(g.pathParams)
+	if g.query != nil {
+		newGen.query = make(url.Values, len(g.query))
+		for k, v := range g.query {
+			newGen.query[k] = slices.Clone(v)
+		}
+	}
+	return &newGen
 }
 
 func (g *genRequest) getNewRequest() *Request {
@@ -36,12 +92,23 @@ func (g *genRequest) getNewRequest() *Request {
 	return req
 }
 
+// newCacheResponse 生成返回值，使用缓存数据时按本次请求的字符集转换原始内容
+func (g *genRequest) newCacheResponse(req *Request) *Response {
+	resp := newResponse(req)
+	resp.cli = g.cli
+	resp.charset = g.respCharset
+	return resp
+}
+
 func (g *genRequest) Submit(ctx context.Context) *Response {
-	g.buildGenRequest()
+	err := g.buildGenRequest()
 
-	resp := newResponse(g.getNewRequest())
+	resp := g.newCacheResponse(g.getNewRequest())
+	resp.UrlTemplate = g.urlTemplate
 
-	err := g.checkParam()
+	if err == nil {
+		err = g.checkParam()
+	}
 	if err != nil {
 		resp.Error = err
 		return resp
@@ -51,47 +118,131 @@ func (g *genRequest) Submit(ctx context.Context) *Response {
 		ctx = context.Background()
 	}
 
-	if g.cacheTime > 0 {
+	if g.cacheEnabled() || g.httpCacheMode != HttpCacheClose || g.canSingleFlight() {
+		resp.CacheKey = g.getCacheKey(ctx)
+	}
+
+	var httpEntry *httpCacheEntry
+	var staleData *responseCacheStruct //可以在请求失败时返回的过期数据
+	var staleHttpEntry *httpCacheEntry //http语义缓存中可以在请求失败时返回的过期数据
+	if g.httpCacheMode != HttpCacheClose {
 		now := time.Now()
-		respTxt := g.getDataFromCache(ctx)
-		if respTxt != "" {
-			resp.Response = respTxt
-			resp.fromCache = true
+		httpEntry = g.getHttpCacheEntry(ctx, resp.CacheKey)
+		fresh := g.useFreshHttpCache(httpEntry)
+		if fresh || (!g.cacheRefresh && g.useStaleHttpCache(httpEntry, ccStaleWhileRevalidate, g.staleWhileRevalidate)) {
+			resp = httpEntry.toResponse(resp)
+			resp.stale = !fresh
 			resp.setCostTime(now)
 
-			logStr := fmt.Sprintf("[comm-request cache return]id:%s", resp.Id)
+			logStr := fmt.Sprintf("[comm-request http cache return]id:%s, stale:%v", resp.Id, resp.stale)
 			printLog(ctx, g.cli.logger, 0, g.defaultPrintLogInt, logStr)
 
+			if resp.stale {
+				g.refreshCacheAsync(ctx, resp.CacheKey)
+			}
 			return resp
 		}
+		if g.useStaleHttpCache(httpEntry, ccStaleIfError, g.staleIfError) {
+			staleHttpEntry = httpEntry
+		}
+		g.setHttpCacheValidator(httpEntry)
+	} else if g.cacheEnabled() && !g.cacheRefresh {
+		now := time.Now()
+		cacheData, age := g.getDataFromCache(ctx, resp.CacheKey)
+		if cacheData != nil {
+			stale := !cacheData.Negative && age > g.cacheTime
+			if !stale || age <= g.cacheTime+g.staleWhileRevalidate {
+				resp = cacheData.toResponse(resp)
+				resp.stale = stale
+				resp.setCostTime(now)
+
+				logStr := fmt.Sprintf("[comm-request cache return]id:%s, stale:%v", resp.Id, stale)
+				printLog(ctx, g.cli.logger, 0, g.defaultPrintLogInt, logStr)
+
+				if stale || (!cacheData.Negative && g.needRefreshAhead(age)) {
+					g.refreshCacheAsync(ctx, resp.CacheKey)
+				}
+				return resp
+			}
+			if age <= g.cacheTime+g.staleIfError {
+				staleData = cacheData
+			}
+		}
 	}
 
-	dataString, _ := getDataString(g.Data)
+	dataString, _ := g.getBodyString()
 
-	postUrl := getNewUrl(g.Url, g.Method, dataString)
+	postUrl, err := g.getQueryUrl(dataString)
+	if err != nil {
+		resp.Error = err
+		return resp
+	}
 
-	logStr := fmt.Sprintf("[comm-request request] url:%s", postUrl)
+	logStr := fmt.Sprintf("[comm-request request] url:%s", g.logUrl(postUrl))
 	printLog(ctx, g.cli.logger, 0, g.defaultPrintLogInt, logStr)
 
-	allResp := g.httpRequest(ctx, dataString, resp)
+	allResp := g.singleFlightRequest(ctx, dataString, resp)
 
 	//返回结果的日志
 	printLoggerResponse(ctx, g.cli.logger, g.defaultPrintLogInt, allResp)
 
-	if g.cacheTime > 0 && allResp.Response != "" {
-		if allResp.Error == nil && g.cacheTime > 0 {
-			//有个方法对是否进行缓存进行验证，避免保存了业务错误信息
-			if g.checkCacheFunc != nil {
-				if g.checkCacheFunc(allResp) {
-					g.setDataToCache(ctx, allResp)
-				}
-			} else {
-				if allResp.StatusCode == http.StatusOK {
-					g.setDataToCache(ctx, allResp)
-				}
-			}
+	g.invalidateTagsAfterSubmit(ctx, allResp)
+
+	if g.httpCacheMode != HttpCacheClose {
+		if staleHttpEntry != nil && isStaleIfErrorResponse(allResp) {
+			return g.staleIfErrorResponse(ctx, resp, allResp, staleHttpEntry.toResponse(g.newCacheResponse(resp.Request)))
 		}
+		return g.dealHttpCacheResponse(ctx, httpEntry, allResp)
+	}
+
+	if staleData != nil && isStaleIfErrorResponse(allResp) {
+		return g.staleIfErrorResponse(ctx, resp, allResp, staleData.toResponse(g.newCacheResponse(resp.Request)))
+	}
+
+	if negativeTime := g.negativeCacheTimeFor(allResp); negativeTime > 0 {
+		g.setNegativeDataToCache(ctx, allResp, negativeTime)
+	} else if g.canSaveCache(allResp) {
+		g.setDataToCache(ctx, allResp)
 	}
 
 	return allResp
 }
+
+// canSaveCache 返回结果是否可以缓存
+func (g *genRequest) canSaveCache(resp *Response) bool {
+	if g.cacheTime <= 0 || resp.Response == "" || resp.Error != nil {
+		return false
+	}
+	//有个方法对是否进行缓存进行验证，避免保存了业务错误信息
+	if g.checkCacheFunc != nil {
+		return g.checkCacheFunc(resp)
+	}
+	return resp.StatusCode == http.StatusOK
+}
+
+// canSingleFlight 只有GET、HEAD或者开启了缓存的请求才合并，避免合并了写操作
+func (g *genRequest) canSingleFlight() bool {
+	if !g.singleFlight || g.cli.flightGroup == nil {
+		return false
+	}
+	return g.Method == http.MethodGet || g.Method == http.MethodHead ||
+		g.cacheEnabled() || g.httpCacheMode != HttpCacheClose
+}
+
+// singleFlightRequest 开启合并请求时，相同缓存key的并发请求只发起一次
+func (g *genRequest) singleFlightRequest(ctx context.Context, dataString string, resp *Response) *Response {
+	if !g.canSingleFlight() {
+		return g.httpRequest(ctx, dataString, resp)
+	}
+	startTime := time.Now()
+	flightResp := resp.clone()
+	retResp, err := g.cli.flightGroup.do(ctx, resp.CacheKey, g.Timeout, func(ctx context.Context) *Response {
+		return g.httpRequest(ctx, dataString, flightResp)
+	})
+	if err != nil {
+		resp.Error = err
+		resp.setCostTime(startTime)
+		return resp
+	}
+	return retResp
+}
@@ -0,0 +1,131 @@
+package curl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+)
+
+var headerContentTypeXmlUtf8 = "application/xml; charset=utf-8"
+
+// SetJSON data按json格式提交，字符串直接提交
+func (g *genRequest) SetJSON() *genRequest {
+	return g.SetCodec(headerContentTypeJsonUtf8)
+}
+
+// SetForm data按 x-www-form-urlencoded 格式提交，map、struct、url.Values 以及json字符串都会转为表单，
+// 嵌套和数组的格式与 SetQueryStyle 一致
+func (g *genRequest) SetForm() *genRequest {
+	return g.SetCodec(headerContentTypeFormUrlencoded)
+}
+
+// SetXML data按xml格式提交，使用 encoding/xml，字符串直接提交
+func (g *genRequest) SetXML() *genRequest {
+	return g.SetCodec(headerContentTypeXmlUtf8)
+}
+
+// SetCodec data使用contentType对应的codec编码，比如 application/x-msgpack，codec通过 RegisterCodec 或 WithCodec 注册
+func (g *genRequest) SetCodec(contentType string) *genRequest {
+	g.bodyRaw = false
+	g.bodyContentType = contentType
+	return g
+}
+
+// SetRaw data原样提交，只支持string和[]byte
+func (g *genRequest) SetRaw(contentType string) *genRequest {
+	g.bodyRaw = true
+	g.bodyContentType = contentType
+	return g
+}
+
+// SetRespMediaType 返回的数据必须能用mediaType对应的codec解码，否则返回错误
+func (g *genRequest) SetRespMediaType(mediaType string) *genRequest {
+	g.respMediaType = mediaType
+	return g
+}
+
+// hasBodyCodec 是否设置了提交格式
+func (g *genRequest) hasBodyCodec() bool {
+	return g.bodyRaw || g.bodyContentType != ""
+}
+
+// getBodyString 按设置的格式序列化data，没有设置时与以前的方式一致，[]byte 认为已经编码过，直接提交
+func (g *genRequest) getBodyString() (string, error) {
+	if g.bodyRaw {
+		return encodeRawBody(g.Data)
+	}
+	if g.soap != nil {
+		return encodeSoapEnvelope(g.soap.version, g.Data)
+	}
+	if g.bodyContentType == "" {
+		return getDataString(g.Data)
+	}
+	if b, ok := g.Data.([]byte); ok {
+		return string(b), nil
+	}
+	codec := g.cli.getCodec(g.bodyContentType)
+	if codec == nil {
+		return "", fmt.Errorf("codec not found: %s", g.bodyContentType)
+	}
+	if _, ok := codec.(*formCodec); ok && g.queryEncoder != nil {
+		codec = &formCodec{encoder: g.queryEncoder}
+	}
+	b, err := codec.Marshal(g.Data)
+	if err != nil {
+		return "", fmt.Errorf("data 编码失败 %s:%w", g.bodyContentType, err)
+	}
+	return string(b), nil
+}
+
+// getBodyHeaders 设置了提交格式时，只在没有Content-Type时设置，不会修改调用方设置的值
+func (g *genRequest) getBodyHeaders() http.Header {
+	headers := beautifulHeader(g.Header)
+	if headers == nil {
+		headers = http.Header{}
+	}
+	if headers.Get(headerContentType) == "" && g.bodyContentType != "" {
+		headers.Set(headerContentType, g.bodyContentType)
+	}
+	return headers
+}
+
+func encodeFormBody(data interface{}, q *queryEncoder) (string, error) {
+	if q == nil {
+		q = &queryEncoder{arrayStyle: QueryArrayRepeat, nestStyle: QueryNestBracket}
+	}
+	values, err := q.encodeData(data)
+	if err != nil {
+		return "", err
+	}
+	if values == nil {
+		//不是json的字符串，直接提交
+		return data.(string), nil
+	}
+	return values.Encode(), nil
+}
+
+func encodeXmlBody(data interface{}) (string, error) {
+	switch val := data.(type) {
+	case string:
+		return val, nil
+	case []byte:
+		return string(val), nil
+	}
+	b, err := xml.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("data 转为xml失败:%w", err)
+	}
+	return string(b), nil
+}
+
+func encodeRawBody(data interface{}) (string, error) {
+	switch val := data.(type) {
+	case string:
+		return val, nil
+	case []byte:
+		return string(val), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("raw data 只支持string和[]byte: %T", data)
+}
@@ -17,8 +17,8 @@ func (g *genRequest) httpRequest(ctx context.Context, dataString string, resp *R
 	resp.Error = nil
 
 	newRequest := g.getNewRequest()
-	if g.cli.handler != nil {
-		err = g.cli.handler.BeforeHandler(ctx, newRequest, httpReq)
+	if handler := g.cli.getHandler(); handler != nil {
+		err = handler.BeforeHandler(ctx, newRequest, httpReq)
 		if err != nil {
 			resp.Error = err
 			return resp
@@ -35,7 +35,7 @@ func (g *genRequest) httpRequest(ctx context.Context, dataString string, resp *R
 	startTime := time.Now()
 
 	if !isRetry {
-		retResp, err := g.requestDo(httpReq, resp)
+		retResp, err := g.requestDo(httpReq, resp, 0)
 		retResp, err = g.requestDoBack(ctx, startTime, retResp, err)
 		if err != nil {
 			retResp.Error = err
@@ -44,10 +44,12 @@ func (g *genRequest) httpRequest(ctx context.Context, dataString string, resp *R
 	}
 
 	var retRespTemp *Response
+	attempt := 0
 
 	//需要重试
 	retResp, err := retry.DoWithData[*Response](func() (*Response, error) {
-		respTemp, err := g.requestDo(httpReq, resp)
+		respTemp, err := g.requestDo(httpReq, resp, attempt)
+		attempt++
 		if respTemp != nil {
 			retRespTemp = respTemp
 			logStr := fmt.Sprintf("[comm-request http-request retry.do]id:%s, error:%v", respTemp.Id, err)
@@ -110,12 +110,81 @@ func (g *genRequest) SetCacheTime(cacheTime time.Duration) *genRequest {
 	return g
 }
 
+// SetNegativeCache 缓存not found的结果，默认404、410，checkFunc用来判断业务上的not found
+func (g *genRequest) SetNegativeCache(cacheTime time.Duration, checkFunc func(resp *Response) bool) *genRequest {
+	g.negativeCacheTime = cacheTime
+	g.negativeCheckFunc = checkFunc
+	return g
+}
+
+// SetErrorCache 缓存请求错误（连接失败、超时等）的结果，避免上游故障时不断重试
+func (g *genRequest) SetErrorCache(cacheTime time.Duration) *genRequest {
+	g.errorCacheTime = cacheTime
+	return g
+}
+
+// SetRefreshAhead 读取缓存时，剩余时间少于缓存时间的percent%，则在后台刷新一次，刷新完成前继续返回旧数据
+func (g *genRequest) SetRefreshAhead(percent int) *genRequest {
+	if percent >= 0 && percent < 100 {
+		g.refreshAheadPercent = percent
+	}
+	return g
+}
+
+// SetCacheKeyFunc 设置生成缓存key的方法，可使用 NewCacheKeyBuilder 生成
+func (g *genRequest) SetCacheKeyFunc(f CacheKeyFunc) *genRequest {
+	g.cacheKeyFunc = f
+	return g
+}
+
+// SetCacheTags 给缓存打上tag，比如 user:42，可通过 InvalidateCacheByTags 删除
+func (g *genRequest) SetCacheTags(tags ...string) *genRequest {
+	g.cacheTags = append(g.cacheTags, tags...)
+	return g
+}
+
+// SetInvalidateTags 请求成功后删除这些tag下的缓存，用于修改数据的请求
+func (g *genRequest) SetInvalidateTags(tags ...string) *genRequest {
+	g.invalidateTags = append(g.invalidateTags, tags...)
+	return g
+}
+
+// SetStaleWhileRevalidate 缓存过期后的d时间内，直接返回旧数据，同时在后台刷新缓存，
+// http语义缓存中与响应的 stale-while-revalidate 指令取较大值
+func (g *genRequest) SetStaleWhileRevalidate(d time.Duration) *genRequest {
+	g.staleWhileRevalidate = d
+	return g
+}
+
+// SetStaleIfError 缓存过期后的d时间内，如果请求失败，则返回旧数据，
+// http语义缓存中与响应的 stale-if-error 指令取较大值
+func (g *genRequest) SetStaleIfError(d time.Duration) *genRequest {
+	g.staleIfError = d
+	return g
+}
+
 // SetCacheCheckFunc 设置缓存检查函数，有些业务错误不允许缓存
 func (g *genRequest) SetCacheCheckFunc(checkFunc func(resp *Response) bool) *genRequest {
 	g.checkCacheFunc = checkFunc
 	return g
 }
 
+// SetSingleFlight 相同缓存key的并发请求合并为一次实际请求，结果复制给所有调用方，实际请求最长执行 SetTimeout 的时间，
+// 只对GET、HEAD或者开启了缓存的请求生效，其他的写操作不会合并
+func (g *genRequest) SetSingleFlight(b bool) *genRequest {
+	g.singleFlight = b
+	return g
+}
+
+// SetHttpCache 设置按http语义缓存，根据 Cache-Control、Expires、ETag 等响应头决定缓存，
+// 没有明确过期时间的响应使用 SetCacheTime 的时间
+func (g *genRequest) SetHttpCache(mode int) *genRequest {
+	if mode == HttpCacheClose || mode == HttpCacheShared || mode == HttpCachePrivate {
+		g.httpCacheMode = mode
+	}
+	return g
+}
+
 func (g *genRequest) SetRetryPolicy(p *RetryPolicy) *genRequest {
 	if p == nil {
 		g.retryPolicy = nil //去掉重试条件
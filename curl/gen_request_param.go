@@ -17,11 +17,12 @@ func genRequestFromRequest(r *Request) *genRequest {
 }
 
 // buildGenRequest 优化一下参数
-func (g *genRequest) buildGenRequest() {
+func (g *genRequest) buildGenRequest() error {
 	if g.Data == nil {
 		g.Data = ""
 	}
-	g.Method = getMethod(g.Method)
+	method, methodErr := getMethod(g.Method)
+	g.Method = method
 
 	if g.Timeout <= 0 {
 		g.Timeout = defaultTimeoutSecond
@@ -34,16 +35,32 @@ func (g *genRequest) buildGenRequest() {
 	}
 
 	g.Url = strings.TrimSpace(g.Url)
-	g.Header = getHeaders(g.Header, g.Method, g.Data)
-
-	if g.cli.handler == nil {
-		g.cli.handler = defaultHandler
+	err := methodErr
+	if err == nil {
+		err = g.expandUrlTemplate()
+	}
+	if err == nil {
+		err = g.mergeQuery()
+	}
+	if err == nil {
+		err = g.mergeClientDefault()
+	}
+	//调用方设置了表单的Content-Type，没有指定提交格式时按表单编码，不修改调用方的Content-Type
+	if !g.hasBodyCodec() && methodDataInBody(g.Method) &&
+		strings.Contains(beautifulHeader(g.Header).Get(headerContentType), headerContentTypeFormUrlencodedKey) {
+		g.bodyContentType = headerContentTypeFormUrlencoded
+	}
+	if g.hasBodyCodec() {
+		g.Header = g.getBodyHeaders()
+	} else {
+		g.Header = getHeaders(g.Header, g.Method, g.Data)
 	}
+	return err
 }
 
 // buildGenRequest 优化一下参数
 func (g *genRequest) checkParam() error {
-	_, err := getDataString(g.Data)
+	_, err := g.getBodyString()
 	if err != nil {
 		return err
 	}
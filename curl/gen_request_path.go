@@ -0,0 +1,159 @@
+package curl
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SetPathParams 设置url模板参数，url中的 {name} 会被替换为转义后的值，
+// 比如 /users/{id}/orders/{orderId}，缺少参数或者有多余参数都会返回错误，不是 {name} 格式的大括号原样保留
+func (g *genRequest) SetPathParams(params map[string]any) *genRequest {
+	if g.pathParams == nil {
+		g.pathParams = make(map[string]any)
+	}
+	for k, v := range params {
+		g.pathParams[k] = v
+	}
+	return g
+}
+
+// expandUrlTemplate 替换url模板参数，保留原始模板，方便日志中使用，避免url太分散，
+// 没有设置参数时路径中有 {name} 也需要检查，避免请求到错误的地址，其他的url不处理
+func (g *genRequest) expandUrlTemplate() error {
+	if g.urlTemplate == "" {
+		if len(g.pathParams) == 0 && !hasPathPlaceholder(g.Url) {
+			return nil
+		}
+		g.urlTemplate = g.Url
+	}
+	newUrl, err := expandPathTemplate(g.urlTemplate, g.pathParams)
+	if err != nil {
+		return err
+	}
+	g.Url = newUrl
+	return nil
+}
+
+// logUrl 日志中显示的url，有模板时使用模板
+func (g *genRequest) logUrl(newUrl string) string {
+	if g.urlTemplate != "" {
+		return g.urlTemplate
+	}
+	return newUrl
+}
+
+// expandPathTemplate ?前面的参数按路径转义，后面的按query转义
+func expandPathTemplate(tpl string, params map[string]any) (string, error) {
+	queryIndex := strings.Index(tpl, "?")
+	usedMap := make(map[string]bool)
+	missList := make([]string, 0)
+
+	var sb strings.Builder
+	for i := 0; i < len(tpl); i++ {
+		name, end, isParam := placeholderAt(tpl, i)
+		if !isParam {
+			sb.WriteByte(tpl[i])
+			continue
+		}
+		val, ok := params[name]
+		if !ok {
+			missList = append(missList, name)
+		} else {
+			str, err := pathParamString(val)
+			if err != nil {
+				return "", fmt.Errorf("url模板参数 %s 错误：%w", name, err)
+			}
+			if queryIndex >= 0 && i > queryIndex {
+				sb.WriteString(url.QueryEscape(str))
+			} else {
+				sb.WriteString(url.PathEscape(str))
+			}
+			usedMap[name] = true
+		}
+		i += end
+	}
+	if len(missList) > 0 {
+		return "", fmt.Errorf("url模板缺少参数：%s, %v", tpl, missList)
+	}
+
+	unusedList := make([]string, 0)
+	for k := range params {
+		if !usedMap[k] {
+			unusedList = append(unusedList, k)
+		}
+	}
+	if len(unusedList) > 0 {
+		sort.Strings(unusedList)
+		return "", fmt.Errorf("url模板中没有使用的参数：%s, %v", tpl, unusedList)
+	}
+	return sb.String(), nil
+}
+
+// placeholderAt i位置是否是 {name} 格式的参数，返回参数名以及 } 相对i的位置
+func placeholderAt(tpl string, i int) (string, int, bool) {
+	if tpl[i] != '{' {
+		return "", 0, false
+	}
+	end := strings.IndexByte(tpl[i:], '}')
+	if end < 0 {
+		return "", 0, false
+	}
+	name := tpl[i+1 : i+end]
+	if !isPathParamName(name) {
+		return "", 0, false
+	}
+	return name, end, true
+}
+
+// hasPathPlaceholder url的路径中是否有 {name} 格式的参数
+func hasPathPlaceholder(rawUrl string) bool {
+	path, _, _ := strings.Cut(rawUrl, "?")
+	for i := 0; i < len(path); i++ {
+		if _, _, ok := placeholderAt(path, i); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isPathParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r == '-' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathParamString 参数值转为字符串，只支持基础类型以及基于基础类型定义的类型，实现了 fmt.Stringer 的优先使用 String()
+func pathParamString(v any) (string, error) {
+	if v == nil {
+		return "", fmt.Errorf("value is nil")
+	}
+	if val, ok := v.(fmt.Stringer); ok {
+		return val.String(), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	}
+	return "", fmt.Errorf("type %T not supported", v)
+}
@@ -0,0 +1,114 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// StatusError 返回的状态码不是2xx
+type StatusError struct {
+	StatusCode int
+	Response   string      //返回的原始内容
+	Body       interface{} //按 SetErrorType 设置的类型解码后的错误内容，没有设置或解码失败时为nil
+}
+
+func (e *StatusError) Error() string {
+	body := []rune(e.Response)
+	if len(body) > defaultPrintLogDataLength {
+		body = body[:defaultPrintLogDataLength]
+	}
+	return fmt.Sprintf("http status: %d, response: %s", e.StatusCode, string(body))
+}
+
+// SetErrorType 设置状态码不是2xx时返回内容的类型，Do、DoInto 会解码到 StatusError.Body 中，可通过 ErrorBody 取得
+func (g *genRequest) SetErrorType(v interface{}) *genRequest {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	g.errorType = t
+	return g
+}
+
+// ErrorBody 从 Do、DoInto 返回的错误中取得解码后的错误内容
+func ErrorBody[E any](err error) (E, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch body := statusErr.Body.(type) {
+		case E:
+			return body, true
+		case *E:
+			if body != nil {
+				return *body, true
+			}
+		}
+	}
+	var e E
+	return e, false
+}
+
+// Do 发送请求，并按返回的Content-Type解码为T，请求错误、状态码不是2xx、解码错误都通过error返回，
+// T为string或[]byte时直接返回原始内容
+func Do[T any](ctx context.Context, gen *genRequest) (T, *Response, error) {
+	var ret T
+	if gen == nil {
+		return ret, nil, errors.New("request is nil")
+	}
+	resp := gen.Submit(ctx)
+	if err := gen.decodeResponse(resp, &ret); err != nil {
+		return ret, resp, err
+	}
+	return ret, resp, nil
+}
+
+// DoInto 使用req作为请求的data，发送请求后解码为Resp
+func DoInto[Req any, Resp any](ctx context.Context, gen *genRequest, req Req) (Resp, *Response, error) {
+	if gen == nil {
+		var ret Resp
+		return ret, nil, errors.New("request is nil")
+	}
+	gen.SetData(req)
+	return Do[Resp](ctx, gen)
+}
+
+// decodeResponse 检查请求错误和状态码，然后解码到v，v为*string、*[]byte时直接使用原始内容
+func (g *genRequest) decodeResponse(resp *Response, v interface{}) error {
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return g.newStatusError(resp)
+	}
+	if resp.Response == "" || v == nil {
+		return nil
+	}
+
+	switch val := v.(type) {
+	case *string:
+		*val = resp.Response
+		return nil
+	case *[]byte:
+		*val = []byte(resp.Response)
+		return nil
+	}
+	if err := resp.Unmarshal(v); err != nil {
+		return fmt.Errorf("response decode error: %w", err)
+	}
+	return nil
+}
+
+// newStatusError 状态码错误，有设置错误类型时解码返回内容
+func (g *genRequest) newStatusError(resp *Response) *StatusError {
+	statusErr := &StatusError{StatusCode: resp.StatusCode, Response: resp.Response}
+	if g.errorType == nil || resp.Response == "" {
+		return statusErr
+	}
+	body := reflect.New(g.errorType)
+	if err := resp.Unmarshal(body.Interface()); err == nil {
+		statusErr.Body = body.Elem().Interface()
+	}
+	return statusErr
+}
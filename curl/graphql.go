@@ -0,0 +1,139 @@
+package curl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"strings"
+)
+
+var (
+	graphqlPersistedQueryVersion  = 1
+	graphqlPersistedQueryNotFound = "PersistedQueryNotFound"
+)
+
+// GraphQLRequest GraphQL请求，query和mutation都放在Query中
+type GraphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+
+	Header         http.Header `json:"-"` //请求头
+	PersistedQuery bool        `json:"-"` //是否使用持久化查询，先只发送Query的sha256，服务端没有时再带上Query重新发送
+}
+
+// GraphQLError errors中的一项
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation 错误在query中的位置
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLErrors 返回内容中有errors时的错误，状态码为200时也会返回
+type GraphQLErrors struct {
+	StatusCode int
+	Errors     []GraphQLError
+}
+
+func (e *GraphQLErrors) Error() string {
+	msgList := make([]string, 0, len(e.Errors))
+	for _, one := range e.Errors {
+		msgList = append(msgList, one.Message)
+	}
+	return fmt.Sprintf("graphql errors: %s", strings.Join(msgList, "; "))
+}
+
+// graphqlResponse GraphQL返回的内容
+type graphqlResponse struct {
+	Data   jsoniter.RawMessage `json:"data"`
+	Errors []GraphQLError      `json:"errors"`
+}
+
+// GraphQL 发送GraphQL请求，返回的data解码到data中，返回内容中有errors时返回 *GraphQLErrors，
+// 同时也会解码data中已有的部分，状态码不是2xx并且不是GraphQL的返回内容时返回 *StatusError
+func (c *client) GraphQL(ctx context.Context, url string, req *GraphQLRequest, data interface{}) (*Response, error) {
+	if req == nil || req.Query == "" {
+		return nil, errors.New("graphql query is empty")
+	}
+	if !req.PersistedQuery {
+		return c.graphqlDo(ctx, url, req, req.Query, data)
+	}
+
+	hash := sha256.Sum256([]byte(req.Query))
+	extensions := make(map[string]interface{}, len(req.Extensions)+1)
+	for k, v := range req.Extensions {
+		extensions[k] = v
+	}
+	extensions["persistedQuery"] = map[string]interface{}{
+		"version":    graphqlPersistedQueryVersion,
+		"sha256Hash": hex.EncodeToString(hash[:]),
+	}
+	persistedReq := *req
+	persistedReq.Extensions = extensions
+
+	resp, err := c.graphqlDo(ctx, url, &persistedReq, "", data)
+	if !isPersistedQueryNotFound(err) {
+		return resp, err
+	}
+	//服务端没有缓存这个query，带上query重新发送，服务端会记录下来
+	return c.graphqlDo(ctx, url, &persistedReq, req.Query, data)
+}
+
+func (c *client) graphqlDo(ctx context.Context, url string, req *GraphQLRequest, query string, data interface{}) (*Response, error) {
+	body := *req
+	body.Query = query
+	gen := c.NewRequest(&Request{Url: url, Method: http.MethodPost, Data: &body, Header: req.Header}).SetJSON()
+	resp := gen.Submit(ctx)
+	if resp.Error != nil {
+		return resp, resp.Error
+	}
+
+	ret := new(graphqlResponse)
+	if err := jsoniter.Unmarshal([]byte(resp.Response), ret); err != nil {
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return resp, gen.newStatusError(resp)
+		}
+		return resp, fmt.Errorf("graphql response decode error: %w", err)
+	}
+	if len(ret.Data) > 0 && string(ret.Data) != "null" && data != nil {
+		if err := jsoniter.Unmarshal(ret.Data, data); err != nil {
+			return resp, fmt.Errorf("graphql data decode error: %w", err)
+		}
+	}
+	if len(ret.Errors) > 0 {
+		return resp, &GraphQLErrors{StatusCode: resp.StatusCode, Errors: ret.Errors}
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, gen.newStatusError(resp)
+	}
+	return resp, nil
+}
+
+// isPersistedQueryNotFound 服务端没有找到持久化查询，兼容放在message和extensions.code中的情况
+func isPersistedQueryNotFound(err error) bool {
+	var gqlErr *GraphQLErrors
+	if !errors.As(err, &gqlErr) {
+		return false
+	}
+	for _, one := range gqlErr.Errors {
+		if one.Message == graphqlPersistedQueryNotFound {
+			return true
+		}
+		if code, ok := one.Extensions["code"].(string); ok && code == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
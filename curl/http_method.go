@@ -0,0 +1,72 @@
+package curl
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DataPlacement 请求的data放在什么位置
+type DataPlacement int
+
+const (
+	DataInBody         DataPlacement = iota // 只放在body中
+	DataInQuery                             // 只放在url参数中
+	DataInQueryAndBody                      // 同时放在url参数和body中
+)
+
+var (
+	methodPlacementMutex sync.RWMutex
+	// methodPlacement 各个方法data的位置，没有配置的方法放在body中，GET、DELETE保持以前的方式
+	methodPlacement = map[string]DataPlacement{
+		http.MethodGet:     DataInQueryAndBody,
+		http.MethodDelete:  DataInQueryAndBody,
+		http.MethodHead:    DataInQuery,
+		http.MethodOptions: DataInQuery,
+		http.MethodTrace:   DataInQuery,
+		http.MethodConnect: DataInQuery,
+	}
+
+	// standardMethods 标准方法不区分大小写
+	standardMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace}
+)
+
+// RegisterMethodPlacement 设置方法的data位置，比如自定义的方法 PURGE 设置为 DataInQuery，自定义的方法区分大小写
+func RegisterMethodPlacement(method string, placement DataPlacement) {
+	methodPlacementMutex.Lock()
+	defer methodPlacementMutex.Unlock()
+	methodPlacement[normalizeMethod(method)] = placement
+}
+
+// normalizeMethod 标准方法不区分大小写，统一转为大写，自定义的方法保持原样
+func normalizeMethod(method string) string {
+	method = strings.TrimSpace(method)
+	for _, one := range standardMethods {
+		if strings.EqualFold(one, method) {
+			return one
+		}
+	}
+	return method
+}
+
+func getMethodPlacement(method string) DataPlacement {
+	methodPlacementMutex.RLock()
+	defer methodPlacementMutex.RUnlock()
+	if placement, ok := methodPlacement[method]; ok {
+		return placement
+	}
+	return DataInBody
+}
+
+// methodDataInQuery data是否放到url参数中
+func methodDataInQuery(method string) bool {
+	placement := getMethodPlacement(method)
+	return placement == DataInQuery || placement == DataInQueryAndBody
+}
+
+// methodDataInBody data是否放到body中
+func methodDataInBody(method string) bool {
+	placement := getMethodPlacement(method)
+	return placement == DataInBody || placement == DataInQueryAndBody
+}
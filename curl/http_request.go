@@ -5,17 +5,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/magic-lib/go-plat-utils/logs"
+	"io"
 	"net/http"
 )
 
 // initHeaders headers
 func (g *genRequest) initHeaders(req *http.Request) {
-	if g.Header == nil || len(g.Header) == 0 {
-		return
-	}
 	for k, v := range g.Header {
 		req.Header = setHeaderValues(req.Header, k, v...)
 	}
+	//缓存重新验证的请求头，不参与请求id的计算
+	for k, v := range g.condHeader {
+		req.Header[k] = v
+	}
 }
 
 // initCookies cookies
@@ -41,22 +43,34 @@ func (g *genRequest) buildHttpRequest(req *http.Request) *http.Request {
 		req = &http.Request{}
 	}
 	g.initHeaders(req)
+	initAcceptEncoding(req)
 	g.initCookies(req)
 	g.initBasicAuth(req)
 	return req
 }
 
 func (g *genRequest) getHttpRequest(ctx context.Context, dataString string) (*http.Request, error) {
-	newUrl := getNewUrl(g.Url, g.Method, dataString)
+	newUrl, err := g.getQueryUrl(dataString)
+	if err != nil {
+		return nil, err
+	}
 
-	httpReq, err := http.NewRequest(g.Method, newUrl, bytes.NewBufferString(dataString))
+	var body io.Reader = http.NoBody
+	if methodDataInBody(g.Method) {
+		body = bytes.NewBufferString(dataString)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, g.Method, newUrl, body)
 	if err != nil {
-		logStr := fmt.Sprintf("[comm-request request] url:%s, error: %s", newUrl, err.Error())
+		logStr := fmt.Sprintf("[comm-request request] url:%s, error: %s", g.logUrl(newUrl), err.Error())
 		printLog(ctx, g.cli.logger, logs.ERROR, g.defaultPrintLogInt, logStr)
 		return nil, err
 	}
 
 	httpReq = g.buildHttpRequest(httpReq)
 
+	if err = g.compressRequestBody(httpReq, dataString); err != nil {
+		return nil, err
+	}
+
 	return httpReq, nil
 }
@@ -3,23 +3,34 @@ package curl
 import (
 	"context"
 	"fmt"
-	jsoniter "github.com/json-iterator/go"
 	"net/http"
 	"time"
 )
 
-// requestDo 发起请求
-func (g *genRequest) requestDo(httpReq *http.Request, retResp *Response) (*Response, error) {
+// requestDo 发起请求，attempt为第几次请求，从0开始
+func (g *genRequest) requestDo(httpReq *http.Request, retResp *Response, attempt int) (*Response, error) {
 	if retResp == nil {
 		retResp = newResponse(g.getNewRequest())
 	}
 
+	//重试时body已经被读取过，需要重新取得，第一次请求直接使用
+	if attempt > 0 && httpReq.GetBody != nil && httpReq.Body != nil && httpReq.Body != http.NoBody {
+		body, err := httpReq.GetBody()
+		if err != nil {
+			retResp.Error = err
+			return retResp, err
+		}
+		httpReq.Body = body
+	}
+
 	resp, err := g.cli.httpCli.Do(httpReq)
 	if err != nil {
 		retResp.Error = err
 		return retResp, err
 	}
 
+	retResp.charset = g.respCharset
+	retResp.maxDecodedSize = g.cli.maxDecodedSize
 	retResp.setAndCloseHttpResp(resp)
 
 	return retResp, nil
@@ -32,8 +43,8 @@ func (g *genRequest) requestDoBack(ctx context.Context, startTime time.Time, ret
 	logStr := fmt.Sprintf("[comm-request http-request return]id:%s, error:%v", retResp.Id, err)
 	printLog(ctx, g.cli.logger, 0, g.defaultPrintLogInt, logStr)
 
-	if g.cli.handler != nil {
-		err = g.cli.handler.AfterHandler(ctx, retResp)
+	if handler := g.cli.getHandler(); handler != nil {
+		err = handler.AfterHandler(ctx, retResp)
 		if err != nil {
 			retResp.Error = err
 			return retResp, err
@@ -41,15 +52,34 @@ func (g *genRequest) requestDoBack(ctx context.Context, startTime time.Time, ret
 	}
 
 	//如果设置了返回的类型，则可以进行判断
-	if g.respDateType == respDataTypeJson {
-		if retResp.Error == nil {
-			var obj interface{}
-			err = jsoniter.Unmarshal([]byte(retResp.Response), &obj)
-			if err != nil {
-				//返回的不是json格式
-				retResp.Error = fmt.Errorf("url: %s, response not json: %s，respDateType=string", retResp.Request.Url, retResp.Response)
-				return retResp, retResp.Error
-			}
+	mediaType := g.respMediaType
+	if mediaType == "" && g.respDateType == respDataTypeJson {
+		mediaType = mediaTypeJson
+	}
+	if mediaType != "" && retResp.Error == nil && retResp.StatusCode != http.StatusNotModified {
+		codec := g.cli.getCodec(mediaType)
+		if codec == nil {
+			retResp.Error = fmt.Errorf("codec not found: %s", mediaType)
+			return retResp, retResp.Error
+		}
+		err = validCodecData(codec, []byte(retResp.Response))
+		if err != nil {
+			//返回的数据格式不对
+			retResp.Error = fmt.Errorf("url: %s, response not %s: %s", retResp.Request.Url, mediaType, retResp.Response)
+			return retResp, retResp.Error
+		}
+	}
+
+	//SOAP的fault转为错误，返回的不是envelope时也返回错误
+	if g.soap != nil && retResp.Error == nil {
+		fault, err := parseSoapFault(retResp)
+		if err != nil {
+			retResp.Error = err
+			return retResp, err
+		}
+		if fault != nil {
+			retResp.Error = fault
+			return retResp, fault
 		}
 	}
 
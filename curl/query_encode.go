@@ -0,0 +1,319 @@
+package curl
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/ChengjinWu/gojson"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryArrayStyle 数组在url参数中的格式
+type QueryArrayStyle int
+
+// QueryNestStyle 嵌套对象在url参数中的格式
+type QueryNestStyle int
+
+const (
+	QueryArrayRepeat   QueryArrayStyle = iota + 1 // a=1&a=2
+	QueryArrayBrackets                            // a[]=1&a[]=2
+	QueryArrayComma                               // a=1,2
+)
+
+const (
+	QueryNestBracket QueryNestStyle = iota + 1 // a[b]=1
+	QueryNestDot                               // a.b=1
+)
+
+var (
+	queryTagName = "url"
+
+	// defaultQueryEncoder 没有设置 SetQueryStyle 时使用，数组重复key，嵌套对象使用中括号
+	defaultQueryEncoder = &queryEncoder{arrayStyle: QueryArrayRepeat, nestStyle: QueryNestBracket}
+)
+
+// queryEncoder data转为url参数
+type queryEncoder struct {
+	arrayStyle QueryArrayStyle
+	nestStyle  QueryNestStyle
+}
+
+// SetQueryStyle 设置data放在url参数中时(GET、DELETE等)的格式，为0时使用 QueryArrayRepeat、QueryNestBracket，
+// data为struct时支持 url:"name,omitempty" 的tag，没有url的tag时使用json的tag，
+// 没有设置时data先转为json，再按 QueryArrayRepeat、QueryNestBracket 编码
+func (g *genRequest) SetQueryStyle(arrayStyle QueryArrayStyle, nestStyle QueryNestStyle) *genRequest {
+	if arrayStyle == 0 {
+		arrayStyle = QueryArrayRepeat
+	}
+	if nestStyle == 0 {
+		nestStyle = QueryNestBracket
+	}
+	g.queryEncoder = &queryEncoder{arrayStyle: arrayStyle, nestStyle: nestStyle}
+	return g
+}
+
+// SetQuery 设置url参数，url中已经有的参数优先，使用url模板时，参数不会出现在日志的模板中
+func (g *genRequest) SetQuery(query url.Values) *genRequest {
+	if g.query == nil {
+		g.query = make(url.Values)
+	}
+	for k, v := range query {
+		g.query[k] = append(g.query[k], v...)
+	}
+	return g
+}
+
+// mergeQuery SetQuery 设置的参数加到url中，已有的参数不添加，多次调用结果一样
+func (g *genRequest) mergeQuery() error {
+	if len(g.query) == 0 || g.Url == "" {
+		return nil
+	}
+	u, err := url.Parse(g.Url)
+	if err != nil {
+		return fmt.Errorf("url格式错误：%s, %v", g.Url, err)
+	}
+	query := u.Query()
+	isChange := false
+	for k, v := range g.query {
+		if query.Has(k) {
+			continue
+		}
+		query[k] = append([]string(nil), v...)
+		isChange = true
+	}
+	if isChange {
+		u.RawQuery = query.Encode()
+		g.Url = u.String()
+	}
+	return nil
+}
+
+// getQueryUrl 取得实际请求的url，没有设置格式时按json转换后的data使用默认格式，data不是json对象时直接拼接
+func (g *genRequest) getQueryUrl(dataString string) (string, error) {
+	if !methodDataInQuery(g.Method) || dataString == "" {
+		return g.Url, nil
+	}
+	var values url.Values
+	var err error
+	if g.queryEncoder != nil {
+		values, err = g.queryEncoder.encodeData(g.Data)
+	} else {
+		values, err = defaultQueryEncoder.encodeData(dataString)
+	}
+	if err != nil {
+		return "", err
+	}
+	if values == nil {
+		return getNewUrl(g.Url, dataString), nil
+	}
+	return getNewUrl(g.Url, values.Encode()), nil
+}
+
+// encodeData 字符串不是json对象时返回nil，按原来的方式直接拼接
+func (q *queryEncoder) encodeData(data interface{}) (url.Values, error) {
+	if str, ok := data.(string); ok {
+		if str == "" || gojson.CheckValid([]byte(str)) != nil {
+			return nil, nil
+		}
+		var obj interface{}
+		if err := jsonNumberApi.Unmarshal([]byte(str), &obj); err != nil {
+			return nil, nil
+		}
+		if _, ok = obj.(map[string]interface{}); !ok {
+			return nil, nil
+		}
+		data = obj
+	}
+
+	v := indirectValue(reflect.ValueOf(data))
+	if !v.IsValid() {
+		return url.Values{}, nil
+	}
+	if v.Kind() != reflect.Map && v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query data 格式目前不支持: %T", data)
+	}
+	values := url.Values{}
+	if err := q.encode(values, "", v); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (q *queryEncoder) encode(values url.Values, key string, v reflect.Value) error {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if str, ok, err := scalarString(v); ok || err != nil {
+		if err != nil {
+			return fmt.Errorf("query %s: %w", key, err)
+		}
+		values.Add(key, str)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		keyList := make([]string, 0, v.Len())
+		keyMap := make(map[string]reflect.Value, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := fmt.Sprint(iter.Key().Interface())
+			keyList = append(keyList, k)
+			keyMap[k] = iter.Value()
+		}
+		sort.Strings(keyList)
+		for _, k := range keyList {
+			if err := q.encode(values, q.nestKey(key, k), keyMap[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		return q.encodeStruct(values, key, v)
+	case reflect.Slice, reflect.Array:
+		return q.encodeArray(values, key, v)
+	}
+	return fmt.Errorf("query %s: type %s not supported", key, v.Type())
+}
+
+func (q *queryEncoder) encodeStruct(values url.Values, key string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, omitEmpty := queryFieldName(field)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		//没有tag的匿名结构体，字段展开到上一层
+		if name == "" && field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct {
+			if err := q.encode(values, key, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if err := q.encode(values, q.nestKey(key, name), fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeArray 元素不是基础类型时，使用下标作为key
+func (q *queryEncoder) encodeArray(values url.Values, key string, v reflect.Value) error {
+	strList := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		ev := indirectValue(v.Index(i))
+		if !ev.IsValid() {
+			continue
+		}
+		str, ok, err := scalarString(ev)
+		if err != nil {
+			return fmt.Errorf("query %s: %w", key, err)
+		}
+		if !ok {
+			for j := 0; j < v.Len(); j++ {
+				if err = q.encode(values, q.nestKey(key, strconv.Itoa(j)), v.Index(j)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		strList = append(strList, str)
+	}
+
+	switch q.arrayStyle {
+	case QueryArrayComma:
+		if len(strList) > 0 {
+			values.Add(key, strings.Join(strList, ","))
+		}
+	case QueryArrayBrackets:
+		for _, one := range strList {
+			values.Add(key+"[]", one)
+		}
+	default:
+		for _, one := range strList {
+			values.Add(key, one)
+		}
+	}
+	return nil
+}
+
+func (q *queryEncoder) nestKey(key, sub string) string {
+	if key == "" {
+		return sub
+	}
+	if q.nestStyle == QueryNestDot {
+		return key + "." + sub
+	}
+	return key + "[" + sub + "]"
+}
+
+// queryFieldName 优先使用url的tag，其次是json的tag
+func queryFieldName(field reflect.StructField) (string, bool) {
+	tag, ok := field.Tag.Lookup(queryTagName)
+	if !ok {
+		tag = field.Tag.Get("json")
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, strings.Contains(","+opts+",", ",omitempty,")
+}
+
+// scalarString 基础类型转为字符串，数字保持原样，返回false表示不是基础类型
+func scalarString(v reflect.Value) (string, bool, error) {
+	if v.CanInterface() {
+		if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			return string(b), true, err
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), true, nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
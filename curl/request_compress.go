@@ -0,0 +1,121 @@
+package curl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	CompressGzip    = "gzip"
+	CompressDeflate = "deflate" //zlib格式，与 Content-Encoding: deflate 一致
+	CompressZstd    = "zstd"
+)
+
+var (
+	headerContentEncoding = "Content-Encoding"
+
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+)
+
+// compressConfig 请求数据的压缩设置
+type compressConfig struct {
+	alg     string
+	minSize int
+}
+
+// SetRequestCompression 请求数据超过minSize字节时使用alg压缩，并设置 Content-Encoding，
+// 在 BeforeHandler 之前压缩，签名使用的是压缩后的数据，alg为空时不压缩，优先于client的设置
+func (g *genRequest) SetRequestCompression(alg string, minSize int) *genRequest {
+	g.compress = &compressConfig{alg: strings.ToLower(alg), minSize: minSize}
+	return g
+}
+
+// WithRequestCompression 设置发送到host的请求默认的压缩方式，host可以带端口，为 * 时对所有的host生效
+func (c *client) WithRequestCompression(host string, alg string, minSize int) *client {
+	if c.compressHosts == nil {
+		c.compressHosts = make(map[string]*compressConfig)
+	}
+	c.compressHosts[strings.ToLower(host)] = &compressConfig{alg: strings.ToLower(alg), minSize: minSize}
+	return c
+}
+
+// getCompressConfig 请求的设置优先，其次是host的设置，host可以带端口
+func (g *genRequest) getCompressConfig(u *url.URL) *compressConfig {
+	if g.compress != nil {
+		return g.compress
+	}
+	if len(g.cli.compressHosts) == 0 {
+		return nil
+	}
+	for _, host := range []string{u.Host, u.Hostname(), "*"} {
+		if cfg, ok := g.cli.compressHosts[strings.ToLower(host)]; ok {
+			return cfg
+		}
+	}
+	return nil
+}
+
+// compressRequestBody 压缩请求数据，调用方已经设置了 Content-Encoding 时不处理
+func (g *genRequest) compressRequestBody(httpReq *http.Request, dataString string) error {
+	if dataString == "" || httpReq.Body == nil || httpReq.Body == http.NoBody {
+		return nil
+	}
+	cfg := g.getCompressConfig(httpReq.URL)
+	if cfg == nil || cfg.alg == "" || len(dataString) < cfg.minSize {
+		return nil
+	}
+	if httpReq.Header.Get(headerContentEncoding) != "" {
+		return nil
+	}
+	b, err := compressData(cfg.alg, []byte(dataString))
+	if err != nil {
+		return err
+	}
+	//GetBody 每次返回新的reader，重试时可以重新发送
+	httpReq.Body = io.NopCloser(bytes.NewReader(b))
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	httpReq.ContentLength = int64(len(b))
+	httpReq.Header.Set(headerContentEncoding, cfg.alg)
+	return nil
+}
+
+func compressData(alg string, data []byte) ([]byte, error) {
+	switch alg {
+	case CompressZstd:
+		zstdEncoderOnce.Do(func() {
+			zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+		})
+		if zstdEncoderErr != nil {
+			return nil, zstdEncoderErr
+		}
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case CompressGzip, CompressDeflate:
+		buf := new(bytes.Buffer)
+		var w io.WriteCloser
+		if alg == CompressGzip {
+			w = gzip.NewWriter(buf)
+		} else {
+			w = zlib.NewWriter(buf)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("request compression not supported: %s", alg)
+}
@@ -1,6 +1,7 @@
 package curl
 
 import (
+	"bytes"
 	"errors"
 	"github.com/magic-lib/go-plat-utils/conv"
 	"io"
@@ -10,16 +11,55 @@ import (
 
 // Response 方法返回的变量，因为外部方法
 type Response struct {
-	Id         string        `json:"id"`
-	Request    *Request      `json:"request"`
-	Response   string        `json:"response"`
-	Header     http.Header   `json:"header"`
-	StatusCode int           `json:"status"`
-	CostTime   time.Duration `json:"costTime"` //请求间隔时间
-	Error      error         `json:"error"`
-	fromCache  bool
-	resp       *http.Response
-	body       []byte
+	Id          string        `json:"id"`
+	CacheKey    string        `json:"cacheKey,omitempty"`    //缓存使用的key
+	UrlTemplate string        `json:"urlTemplate,omitempty"` //替换参数前的url模板，可作为监控的标签
+	Request     *Request      `json:"request"`
+	Response    string        `json:"response"`
+	Header      http.Header   `json:"header"`
+	StatusCode  int           `json:"status"`
+	CostTime    time.Duration `json:"costTime"` //请求间隔时间
+	Error       error         `json:"error"`
+	fromCache   bool
+	stale       bool  //返回的是过期的缓存数据
+	staleError  error //返回过期数据时，实际请求的错误
+	resp        *http.Response
+	body        []byte
+	cli         *client //用来找到解码的codec
+
+	originalSize int64  //解压前的字节数
+	decodedSize  int64  //解压后的字节数
+	charset      string //指定的字符集
+
+	maxDecodedSize int64 //解压后的最大字节数
+}
+
+// FromCache 是否是从缓存中取得的结果
+func (r *Response) FromCache() bool {
+	return r.fromCache
+}
+
+// IsStale 返回的是否是已经过期的缓存数据
+func (r *Response) IsStale() bool {
+	return r.stale
+}
+
+// StaleError 因请求失败而返回过期缓存时，实际请求的错误
+func (r *Response) StaleError() error {
+	return r.staleError
+}
+
+// clone 复制一份返回值，合并请求时每个调用方拿到各自的对象
+func (r *Response) clone() *Response {
+	newResp := *r
+	if r.Request != nil {
+		newReq := *r.Request
+		newReq.Header = r.Request.Header.Clone()
+		newResp.Request = &newReq
+	}
+	newResp.Header = r.Header.Clone()
+	newResp.body = bytes.Clone(r.body)
+	return &newResp
 }
 
 // setCostTime 设置间隔时间
@@ -56,19 +96,31 @@ func (r *Response) setRespContent(resp *http.Response) ([]byte, error) {
 	}
 
 	if len(r.body) > 0 {
-		return r.body, nil
+		return r.decodeCharset(resp.Header.Get(headerContentType), r.body), nil
 	}
 
 	if resp == nil || resp.Body == nil {
 		return nil, errors.New("response or body is nil")
 	}
 
-	b, err := io.ReadAll(resp.Body)
+	transportUncompressed := resp.Uncompressed
+	counter := &countReader{r: resp.Body}
+	reader, closeFunc, err := decodeRespBody(resp, counter, r.maxDecodedSize)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(reader)
+	closeFunc()
 	if err != nil {
 		return nil, err
 	}
+	r.originalSize = counter.n
+	if transportUncompressed {
+		r.originalSize = -1 //已经被http.Transport解压，不知道原始大小
+	}
+	r.decodedSize = int64(len(b))
 	r.body = b
-	return b, nil
+	return r.decodeCharset(resp.Header.Get(headerContentType), b), nil
 }
 func (r *Response) Unmarshal(v interface{}) error {
 	if r.Error != nil {
@@ -79,7 +131,13 @@ func (r *Response) Unmarshal(v interface{}) error {
 		return errors.New("response is empty")
 	}
 
-	return conv.Unmarshal(r.Response, &v)
+	//json和纯文本保持以前的方式，其他类型根据Content-Type使用对应的codec解码
+	codec := r.cli.getCodec(r.Header.Get(headerContentType))
+	switch codec.(type) {
+	case nil, *jsonCodec, *textCodec:
+		return conv.Unmarshal(r.Response, &v)
+	}
+	return codec.Unmarshal([]byte(r.Response), v)
 }
 
 func newResponse(req *Request) *Response {
@@ -2,64 +2,283 @@ package curl
 
 import (
 	"context"
+	"fmt"
 	jsoniter "github.com/json-iterator/go"
-	"github.com/magic-lib/go-plat-utils/cache"
 	"github.com/magic-lib/go-plat-utils/conv"
 	"github.com/magic-lib/go-plat-utils/goroutines"
+	"github.com/magic-lib/go-plat-utils/logs"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
-// responseCacheStruct 返回的缓存结构
+// cacheSkipHeaders 不需要缓存的响应头，与连接相关或者是每个客户端独有的
+var cacheSkipHeaders = []string{"Set-Cookie", "Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Connection", "Transfer-Encoding", "Trailer", "Te", "Upgrade"}
+
+// cacheRequestStruct 缓存的请求信息，缓存可能是共享的，
+// 不保存header、url参数以及请求数据，避免泄露 Authorization、Cookie、token 等
+type cacheRequestStruct struct {
+	Method      string `json:"method,omitempty"`
+	Url         string `json:"url,omitempty"`
+	UrlTemplate string `json:"urlTemplate,omitempty"`
+	CacheKey    string `json:"cacheKey,omitempty"`
+}
+
+// newCacheRequestStruct 取得返回值中可以缓存的请求信息
+func newCacheRequestStruct(p *Response) *cacheRequestStruct {
+	cacheReq := &cacheRequestStruct{
+		UrlTemplate: p.UrlTemplate,
+		CacheKey:    p.CacheKey,
+	}
+	if p.Request != nil {
+		cacheReq.Method = p.Request.Method
+		cacheReq.Url = stripUrlSecret(p.Request.Url)
+	}
+	return cacheReq
+}
+
+// stripUrlSecret 去掉url中的用户信息、参数和锚点
+func stripUrlSecret(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		rawUrl, _, _ = strings.Cut(rawUrl, "?")
+		return rawUrl
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// responseCacheStruct 返回的缓存结构，旧版本只有 CreateTime 和 Response
 type responseCacheStruct struct {
-	CreateTime time.Time `json:"createTime"`
-	Response   string    `json:"response"`
+	CreateTime time.Time           `json:"createTime"`
+	Request    *cacheRequestStruct `json:"request,omitempty"`
+	Response   string              `json:"response"`
+	StatusCode int                 `json:"status,omitempty"`
+	Header     http.Header         `json:"header,omitempty"`
+	Negative   bool                `json:"negative,omitempty"` //是否是not found或者请求错误的缓存
+	ExpireTime time.Time           `json:"expireTime,omitempty"`
+	Error      string              `json:"error,omitempty"`  //请求错误信息
+	Stream     bool                `json:"stream,omitempty"` //流式写入，第一行是元数据，后面是原始的返回内容
+
+	body []byte //原始的返回内容
+}
+
+// newResponseCacheStruct 根据返回值生成缓存结构
+func newResponseCacheStruct(p *Response) *responseCacheStruct {
+	cacheData := &responseCacheStruct{
+		CreateTime: time.Now(),
+		Request:    newCacheRequestStruct(p),
+		Response:   p.Response,
+		StatusCode: p.StatusCode,
+		body:       p.body,
+	}
+	if len(p.Header) > 0 {
+		cacheData.Header = make(http.Header, len(p.Header))
+		for k, v := range p.Header {
+			if containsHeaderKey(cacheSkipHeaders, k) {
+				continue
+			}
+			cacheData.Header[k] = append([]string(nil), v...)
+		}
+	}
+	return cacheData
+}
+
+// toResponse 用缓存数据填充返回值，旧版本的缓存没有状态码，只有200的结果才会被缓存
+func (c *responseCacheStruct) toResponse(resp *Response) *Response {
+	resp.StatusCode = c.StatusCode
+	if resp.StatusCode == 0 && !c.Negative {
+		resp.StatusCode = http.StatusOK
+	}
+	resp.Header = c.Header.Clone()
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	resp.setCacheBody(c.Response, c.body)
+	//旧版本的缓存没有请求信息，使用本次的请求
+	if c.Request != nil {
+		resp.Request = &Request{Url: c.Request.Url, Method: c.Request.Method}
+		if c.Request.UrlTemplate != "" {
+			resp.UrlTemplate = c.Request.UrlTemplate
+		}
+		if c.Request.CacheKey != "" {
+			resp.CacheKey = c.Request.CacheKey
+		}
+	}
+	if c.Error != "" {
+		resp.Error = &cachedError{msg: c.Error}
+	}
+	resp.fromCache = true
+	return resp
 }
 
 func (g *genRequest) setDataToCache(ctx context.Context, p *Response) {
-	if g.cacheTime == 0 || g.cli.cacheIns == nil {
+	if g.cacheTime == 0 {
+		return
+	}
+	g.saveCacheData(ctx, p, newResponseCacheStruct(p), g.cacheStoreTime())
+}
+
+// saveCacheData 写入缓存
+func (g *genRequest) saveCacheData(ctx context.Context, p *Response, cacheData *responseCacheStruct, storeTime time.Duration) {
+	if g.cli.cacheIns == nil || storeTime <= 0 {
 		return
 	}
 
-	cacheId := p.Id
-	if p.Id == "" {
+	cacheId := p.CacheKey
+	if cacheId == "" {
 		cacheId = getRequestId(p.Request)
 	}
 
-	goroutines.GoAsync(func(params ...interface{}) {
-		cacheData := responseCacheStruct{
-			CreateTime: time.Now(),
-			Response:   p.Response,
+	//先写索引再写缓存，能读到的缓存一定可以按tag删除
+	saveFunc := func(params ...interface{}) {
+		if store := g.cli.cacheStreamStore(); store != nil {
+			g.addCacheIndex(ctx, cacheNamespace, cacheId)
+			_ = g.cli.writeStreamCacheData(ctx, store, cacheEntryKey(cacheNamespace, cacheId), cacheData, storeTime)
+			return
 		}
 		cacheStr := conv.String(cacheData)
 		if cacheStr == "" {
 			return
 		}
+		g.addCacheIndex(ctx, cacheNamespace, cacheId)
+		_, _ = g.cli.setCacheEntry(ctx, cacheNamespace, cacheId, cacheStr, storeTime)
+	}
+	if g.cacheSync {
+		saveFunc()
+		return
+	}
+	goroutines.GoAsync(saveFunc)
+}
 
-		_, _ = cache.NsSet[string](ctx, g.cli.cacheIns, cacheNamespace, cacheId, cacheStr, g.cacheTime)
-	})
+// needRefreshAhead 缓存快要过期时，需要提前刷新
+func (g *genRequest) needRefreshAhead(age time.Duration) bool {
+	if g.refreshAheadPercent <= 0 || g.cacheTime <= 0 {
+		return false
+	}
+	return age >= g.cacheTime*time.Duration(100-g.refreshAheadPercent)/100
 }
 
-func (g *genRequest) getDataFromCache(ctx context.Context) string {
-	if g.cacheTime == 0 || g.cli.cacheIns == nil {
-		return ""
+// cacheStoreTime 缓存实际保存的时间，需要包含可以使用过期数据的时间
+func (g *genRequest) cacheStoreTime() time.Duration {
+	storeTime := g.cacheTime + max(g.staleWhileRevalidate, g.staleIfError)
+	if storeTime > defaultMaxCacheTime {
+		storeTime = defaultMaxCacheTime
 	}
-	cacheId := getRequestId(g.getNewRequest())
+	return storeTime
+}
 
-	retData, err := cache.NsGet[string](ctx, g.cli.cacheIns, cacheNamespace, cacheId)
-	if err != nil || retData == "" {
-		return ""
+// getDataFromCache 取得缓存数据以及已缓存的时长，超出可使用过期数据时间的会被删除
+func (g *genRequest) getDataFromCache(ctx context.Context, cacheId string) (*responseCacheStruct, time.Duration) {
+	if !g.cacheEnabled() || g.cli.cacheIns == nil || cacheId == "" {
+		return nil, 0
 	}
 
-	cacheData := new(responseCacheStruct)
-	err = jsoniter.Unmarshal([]byte(retData), cacheData)
+	cacheData, err := g.cli.readCacheData(ctx, cacheId)
 	if err != nil {
-		_, _ = cache.NsDel[string](ctx, g.cli.cacheIns, cacheNamespace, cacheId)
-		return ""
+		_, _ = g.cli.delCacheEntry(ctx, cacheNamespace, cacheId)
+		return nil, 0
+	}
+	if cacheData == nil {
+		return nil, 0
 	}
 	//超时
-	if time.Now().Sub(cacheData.CreateTime) > g.cacheTime {
-		_, _ = cache.NsDel[string](ctx, g.cli.cacheIns, cacheNamespace, cacheId)
-		return ""
+	age := time.Now().Sub(cacheData.CreateTime)
+	if cacheData.Negative {
+		if time.Now().After(cacheData.ExpireTime) {
+			_, _ = g.cli.delCacheEntry(ctx, cacheNamespace, cacheId)
+			return nil, 0
+		}
+		return cacheData, age
+	}
+	if g.cacheTime == 0 || age > g.cacheStoreTime() {
+		_, _ = g.cli.delCacheEntry(ctx, cacheNamespace, cacheId)
+		return nil, 0
+	}
+	return cacheData, age
+}
+
+// readCacheData 读取返回内容的缓存，不存在时返回nil，数据格式错误时返回error
+func (c *client) readCacheData(ctx context.Context, cacheId string) (*responseCacheStruct, error) {
+	if store := c.cacheStreamStore(); store != nil {
+		return c.readStreamCacheData(ctx, store, cacheEntryKey(cacheNamespace, cacheId))
+	}
+	retData, err := c.getCacheEntry(ctx, cacheNamespace, cacheId)
+	if err != nil || retData == "" {
+		return nil, nil
+	}
+	cacheData := new(responseCacheStruct)
+	if err = jsoniter.Unmarshal([]byte(retData), cacheData); err != nil {
+		return nil, err
+	}
+	return cacheData, nil
+}
+
+// writeStreamCacheData 第一行写入元数据，后面直接写入原始的返回内容，大的返回内容不需要再转为json字符串
+func (c *client) writeStreamCacheData(ctx context.Context, store CacheStreamStore, key string, cacheData *responseCacheStruct, storeTime time.Duration) error {
+	meta := *cacheData
+	meta.Response = ""
+	meta.Stream = true
+	body := cacheData.body
+	if body == nil {
+		body = []byte(cacheData.Response)
+	}
+	return c.setStreamCacheEntry(ctx, store, key, &meta, body, storeTime)
+}
+
+// readStreamCacheData 读取流式写入的缓存，兼容整体写入的json
+func (c *client) readStreamCacheData(ctx context.Context, store CacheStreamStore, key string) (*responseCacheStruct, error) {
+	line, body, err := c.getStreamCacheEntry(ctx, store, key)
+	if err != nil || line == nil {
+		return nil, err
+	}
+	cacheData := new(responseCacheStruct)
+	if err = jsoniter.Unmarshal(line, cacheData); err != nil {
+		return nil, err
+	}
+	if cacheData.Stream {
+		cacheData.body = body
+	}
+	return cacheData, nil
+}
+
+// refreshCacheAsync 后台重新请求并更新缓存，同一个缓存id同时只会有一个刷新
+func (g *genRequest) refreshCacheAsync(ctx context.Context, cacheId string) {
+	if _, loaded := g.cli.refreshingIds.LoadOrStore(cacheId, struct{}{}); loaded {
+		return
+	}
+	newGen := g.clone()
+	newGen.cacheRefresh = true
+	goroutines.GoAsync(func(params ...interface{}) {
+		defer g.cli.refreshingIds.Delete(cacheId)
+		_ = newGen.Submit(context.WithoutCancel(ctx))
+	})
+}
+
+// isStaleIfErrorResponse 请求失败，可以返回过期的缓存数据
+func isStaleIfErrorResponse(resp *Response) bool {
+	return resp.Error != nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// staleIfErrorResponse 请求失败时返回过期的缓存数据，实际请求的错误放在 StaleError 中
+func (g *genRequest) staleIfErrorResponse(ctx context.Context, resp *Response, allResp *Response, staleResp *Response) *Response {
+	logStr := fmt.Sprintf("[comm-request stale-if-error return]id:%s, error:%v", allResp.Id, allResp.Error)
+	printLog(ctx, g.cli.logger, logs.WARNING, g.defaultPrintLogInt, logStr)
+
+	staleResp.UrlTemplate = resp.UrlTemplate
+	staleResp.CacheKey = resp.CacheKey
+	staleResp.cli = resp.cli
+	staleResp.CostTime = allResp.CostTime
+	staleResp.stale = true
+	staleResp.staleError = allResp.Error
+	if staleResp.staleError == nil {
+		staleResp.staleError = fmt.Errorf("http status: %d", allResp.StatusCode)
 	}
-	return cacheData.Response
+	return staleResp
 }
@@ -0,0 +1,409 @@
+package curl
+
+import (
+	"context"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/samber/lo"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HttpCacheClose   = iota //不使用http语义缓存
+	HttpCacheShared         //共享缓存，不会存储private的响应
+	HttpCachePrivate        //私有缓存，private的响应也可以存储
+)
+
+var (
+	headerCacheControl    = "Cache-Control"
+	headerExpires         = "Expires"
+	headerDate            = "Date"
+	headerAge             = "Age"
+	headerETag            = "ETag"
+	headerLastModified    = "Last-Modified"
+	headerVary            = "Vary"
+	headerIfNoneMatch     = "If-None-Match"
+	headerIfModifiedSince = "If-Modified-Since"
+	headerAuthorization   = "Authorization"
+
+	ccStaleWhileRevalidate = "stale-while-revalidate"
+	ccStaleIfError         = "stale-if-error"
+
+	httpCacheNamespace = "comm-request-http"
+
+	//没有明确过期时间时，可以按启发式规则缓存的状态码 RFC 9110 15.1
+	httpCacheHeuristicStatus = []int{
+		http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMultipleChoices, http.StatusMovedPermanently,
+		http.StatusPermanentRedirect, http.StatusNotFound, http.StatusMethodNotAllowed,
+		http.StatusGone, http.StatusRequestURITooLong, http.StatusNotImplemented,
+	}
+
+	//304更新缓存时，不能覆盖的header
+	httpCacheSkipUpdateHeaders = []string{"Content-Length", "Content-Encoding", "Transfer-Encoding", "Content-Range"}
+)
+
+// httpCacheEntry http语义缓存的结构
+type httpCacheEntry struct {
+	CreateTime time.Time         `json:"createTime"`
+	ExpireTime time.Time         `json:"expireTime"` //新鲜度截止时间，过了以后需要重新验证
+	StatusCode int               `json:"status"`
+	Header     http.Header       `json:"header"`
+	Response   string            `json:"response"`
+	Vary       map[string]string `json:"vary"`             //Vary中指定的请求头以及当时请求的值
+	Stream     bool              `json:"stream,omitempty"` //流式写入，第一行是元数据，后面是原始的返回内容
+
+	body []byte //原始的返回内容
+}
+
+// cacheControl Cache-Control 指令
+type cacheControl map[string]string
+
+// parseCacheControl 解析 Cache-Control，指令名统一转为小写
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, line := range h.Values(headerCacheControl) {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, val, _ := strings.Cut(part, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			cc[name] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds 取得秒数类型的指令值
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	val, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	sec, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec) * time.Second, true
+}
+
+func (e *httpCacheEntry) isFresh() bool {
+	return time.Now().Before(e.ExpireTime)
+}
+
+func (e *httpCacheEntry) hasValidator() bool {
+	return e.Header.Get(headerETag) != "" || e.Header.Get(headerLastModified) != ""
+}
+
+// matchVary 请求头是否与缓存时Vary指定的请求头一致
+func (e *httpCacheEntry) matchVary(reqHeader http.Header) bool {
+	for k, v := range e.Vary {
+		if k == "*" {
+			return false
+		}
+		if strings.Join(reqHeader.Values(k), ",") != v {
+			return false
+		}
+	}
+	return true
+}
+
+// toResponse 用缓存数据填充返回值
+func (e *httpCacheEntry) toResponse(resp *Response) *Response {
+	resp.StatusCode = e.StatusCode
+	resp.Header = e.Header.Clone()
+	resp.setCacheBody(e.Response, e.body)
+	resp.fromCache = true
+	age := int64(time.Now().Sub(e.CreateTime).Seconds())
+	if age > 0 {
+		resp.Header.Set(headerAge, strconv.FormatInt(age, 10))
+	}
+	return resp
+}
+
+// freshnessLifetime 计算响应的新鲜度时长 RFC 9111 4.2.1
+func (g *genRequest) freshnessLifetime(resp *Response, cc cacheControl) (time.Duration, bool) {
+	if g.httpCacheMode == HttpCacheShared {
+		if d, ok := cc.seconds("s-maxage"); ok {
+			return d, true
+		}
+	}
+	if d, ok := cc.seconds("max-age"); ok {
+		return d, true
+	}
+	if exp := resp.Header.Get(headerExpires); exp != "" {
+		expTime, err := http.ParseTime(exp)
+		if err != nil {
+			return 0, true //无效的Expires表示已经过期
+		}
+		date := time.Now()
+		if dateTime, err := http.ParseTime(resp.Header.Get(headerDate)); err == nil {
+			date = dateTime
+		}
+		if expTime.Before(date) {
+			return 0, true
+		}
+		return expTime.Sub(date), true
+	}
+	//启发式过期时间，优先用请求设置的缓存时间，其次用 Last-Modified 的10%
+	if g.cacheTime > 0 {
+		return g.cacheTime, false
+	}
+	if lm, err := http.ParseTime(resp.Header.Get(headerLastModified)); err == nil {
+		if d := time.Now().Sub(lm) / 10; d > 0 {
+			return d, false
+		}
+	}
+	return 0, false
+}
+
+// canStoreHttpCache 响应是否允许存储 RFC 9111 3
+func (g *genRequest) canStoreHttpCache(resp *Response, reqCc, respCc cacheControl) bool {
+	if g.Method != http.MethodGet && g.Method != http.MethodHead {
+		return false
+	}
+	if resp.Error != nil || resp.StatusCode == 0 || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	if reqCc.has("no-store") || respCc.has("no-store") {
+		return false
+	}
+	if g.httpCacheMode == HttpCacheShared {
+		if respCc.has("private") {
+			return false
+		}
+		//带认证信息的请求，共享缓存必须要有明确允许的指令
+		if g.Header.Get(headerAuthorization) != "" {
+			if !respCc.has("public") && !respCc.has("s-maxage") && !respCc.has("must-revalidate") {
+				return false
+			}
+		}
+	}
+	if strings.TrimSpace(resp.Header.Get(headerVary)) == "*" {
+		return false
+	}
+	return true
+}
+
+// getHttpCacheEntry 取得缓存数据，不匹配Vary的当作没有缓存
+func (g *genRequest) getHttpCacheEntry(ctx context.Context, cacheId string) *httpCacheEntry {
+	if g.httpCacheMode == HttpCacheClose || g.cli.cacheIns == nil || cacheId == "" {
+		return nil
+	}
+	if parseCacheControl(g.Header).has("no-store") {
+		return nil
+	}
+	entry, err := g.cli.readHttpCacheEntry(ctx, cacheId)
+	if err != nil {
+		_, _ = g.cli.delCacheEntry(ctx, httpCacheNamespace, cacheId)
+		return nil
+	}
+	if entry == nil || !entry.matchVary(g.Header) {
+		return nil
+	}
+	return entry
+}
+
+// readHttpCacheEntry 读取http语义缓存，不存在时返回nil，数据格式错误时返回error
+func (c *client) readHttpCacheEntry(ctx context.Context, cacheId string) (*httpCacheEntry, error) {
+	var line, body []byte
+	if store := c.cacheStreamStore(); store != nil {
+		var err error
+		if line, body, err = c.getStreamCacheEntry(ctx, store, cacheEntryKey(httpCacheNamespace, cacheId)); err != nil {
+			return nil, err
+		}
+	} else {
+		retData, err := c.getCacheEntry(ctx, httpCacheNamespace, cacheId)
+		if err != nil {
+			return nil, nil
+		}
+		line = []byte(retData)
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	entry := new(httpCacheEntry)
+	if err := jsoniter.Unmarshal(line, entry); err != nil {
+		return nil, err
+	}
+	if entry.Stream {
+		entry.body = body
+	}
+	return entry, nil
+}
+
+// writeHttpCacheEntry 写入http语义缓存，支持流式读写时直接写入原始的返回内容
+func (c *client) writeHttpCacheEntry(ctx context.Context, cacheId string, entry *httpCacheEntry, storeTime time.Duration) error {
+	if store := c.cacheStreamStore(); store != nil {
+		meta := *entry
+		meta.Response = ""
+		meta.Stream = true
+		body := entry.body
+		if body == nil {
+			body = []byte(entry.Response)
+		}
+		return c.setStreamCacheEntry(ctx, store, cacheEntryKey(httpCacheNamespace, cacheId), &meta, body, storeTime)
+	}
+	cacheStr := conv.String(entry)
+	if cacheStr == "" {
+		return nil
+	}
+	_, err := c.setCacheEntry(ctx, httpCacheNamespace, cacheId, cacheStr, storeTime)
+	return err
+}
+
+// useFreshHttpCache 请求是否可以直接使用未过期的缓存
+func (g *genRequest) useFreshHttpCache(entry *httpCacheEntry) bool {
+	if entry == nil || !entry.isFresh() {
+		return false
+	}
+	reqCc := parseCacheControl(g.Header)
+	if reqCc.has("no-cache") {
+		return false
+	}
+	if d, ok := reqCc.seconds("max-age"); ok && time.Now().Sub(entry.CreateTime) > d {
+		return false
+	}
+	respCc := parseCacheControl(entry.Header)
+	if respCc.has("no-cache") {
+		return false
+	}
+	return true
+}
+
+// httpStaleWindow 过期后还可以使用旧数据的时长，取请求设置的时长与响应中对应指令 RFC 5861 的较大值，
+// 要求必须重新验证的响应不能使用过期数据
+func (g *genRequest) httpStaleWindow(entry *httpCacheEntry, directive string, d time.Duration) time.Duration {
+	respCc := parseCacheControl(entry.Header)
+	if respCc.has("must-revalidate") || respCc.has("no-cache") ||
+		(g.httpCacheMode == HttpCacheShared && respCc.has("proxy-revalidate")) {
+		return 0
+	}
+	if parseCacheControl(g.Header).has("no-cache") {
+		return 0
+	}
+	if sec, ok := respCc.seconds(directive); ok && sec > d {
+		d = sec
+	}
+	return d
+}
+
+// useStaleHttpCache 过期的缓存是否还在可以使用的时间内
+func (g *genRequest) useStaleHttpCache(entry *httpCacheEntry, directive string, d time.Duration) bool {
+	if entry == nil || entry.isFresh() {
+		return false
+	}
+	window := g.httpStaleWindow(entry, directive, d)
+	return window > 0 && time.Now().Sub(entry.ExpireTime) <= window
+}
+
+// setHttpCacheValidator 缓存过期后，带上验证头去服务端确认
+func (g *genRequest) setHttpCacheValidator(entry *httpCacheEntry) {
+	if entry == nil || !entry.hasValidator() {
+		return
+	}
+	g.condHeader = http.Header{}
+	if etag := entry.Header.Get(headerETag); etag != "" {
+		g.condHeader.Set(headerIfNoneMatch, etag)
+	}
+	if lm := entry.Header.Get(headerLastModified); lm != "" {
+		g.condHeader.Set(headerIfModifiedSince, lm)
+	}
+}
+
+// dealHttpCacheResponse 处理服务端返回，304转为缓存结果，可缓存的存储起来
+func (g *genRequest) dealHttpCacheResponse(ctx context.Context, entry *httpCacheEntry, resp *Response) *Response {
+	if g.httpCacheMode == HttpCacheClose || g.cli.cacheIns == nil {
+		return resp
+	}
+
+	if resp.Error == nil && resp.StatusCode == http.StatusNotModified && entry != nil && g.condHeader != nil {
+		newHeader := entry.Header.Clone()
+		for k, v := range resp.Header {
+			if containsHeaderKey(httpCacheSkipUpdateHeaders, k) {
+				continue
+			}
+			newHeader[k] = v
+		}
+		entry.Header = newHeader
+		entry.CreateTime = time.Now()
+		resp = entry.toResponse(resp)
+	}
+
+	reqCc := parseCacheControl(g.Header)
+	respCc := parseCacheControl(resp.Header)
+	if !g.canStoreHttpCache(resp, reqCc, respCc) {
+		return resp
+	}
+
+	lifetime, explicit := g.freshnessLifetime(resp, respCc)
+	if !explicit && !lo.Contains(httpCacheHeuristicStatus, resp.StatusCode) {
+		return resp
+	}
+	if age, err := strconv.ParseInt(resp.Header.Get(headerAge), 10, 64); err == nil && !resp.fromCache {
+		lifetime -= time.Duration(age) * time.Second
+	}
+
+	newEntry := &httpCacheEntry{
+		CreateTime: time.Now(),
+		ExpireTime: time.Now().Add(lifetime),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Response:   resp.Response,
+		body:       resp.body,
+	}
+	newEntry.Header.Del(headerAge)
+	if vary := resp.Header.Values(headerVary); len(vary) > 0 {
+		newEntry.Vary = make(map[string]string)
+		for _, line := range vary {
+			for _, name := range strings.Split(line, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				newEntry.Vary[name] = strings.Join(g.Header.Values(name), ",")
+			}
+		}
+	}
+
+	//有验证头的，过期后还可以用来重新验证，保存时间延长，可以使用过期数据的也需要延长
+	storeTime := lifetime + max(g.httpStaleWindow(newEntry, ccStaleWhileRevalidate, g.staleWhileRevalidate),
+		g.httpStaleWindow(newEntry, ccStaleIfError, g.staleIfError))
+	if newEntry.hasValidator() {
+		storeTime = defaultMaxCacheTime
+	}
+	if storeTime <= 0 {
+		return resp
+	}
+	if storeTime > defaultMaxCacheTime {
+		storeTime = defaultMaxCacheTime
+	}
+
+	cacheId := resp.CacheKey
+	if cacheId == "" {
+		cacheId = g.getCacheKey(ctx)
+	}
+	g.addCacheIndex(ctx, httpCacheNamespace, cacheId)
+	_ = g.cli.writeHttpCacheEntry(ctx, cacheId, newEntry, storeTime)
+	return resp
+}
+
+// containsHeaderKey header的key是否在列表中，不区分大小写
+func containsHeaderKey(list []string, key string) bool {
+	for _, one := range list {
+		if strings.EqualFold(one, key) {
+			return true
+		}
+	}
+	return false
+}
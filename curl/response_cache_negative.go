@@ -0,0 +1,82 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrCachedError 从缓存中取得的请求错误，可通过 errors.Is 判断，错误信息与原始错误相同
+var ErrCachedError = errors.New("cached request error")
+
+// negativeCacheStatus 默认按not found缓存的状态码
+var negativeCacheStatus = []int{http.StatusNotFound, http.StatusGone}
+
+// cachedError 缓存中恢复的错误，原始错误的类型无法保存
+type cachedError struct {
+	msg string
+}
+
+func (e *cachedError) Error() string {
+	return e.msg
+}
+
+func (e *cachedError) Is(target error) bool {
+	return target == ErrCachedError
+}
+
+// cacheEnabled 是否设置了缓存
+func (g *genRequest) cacheEnabled() bool {
+	return g.cacheTime > 0 || g.negativeCacheTime > 0 || g.errorCacheTime > 0
+}
+
+// negativeCacheTimeFor 返回结果对应的negative缓存时间，0表示不缓存
+func (g *genRequest) negativeCacheTimeFor(resp *Response) time.Duration {
+	if resp.Error != nil {
+		//调用方自己取消或超时，不是上游的错误，不能影响其他调用方
+		if errors.Is(resp.Error, context.Canceled) || errors.Is(resp.Error, context.DeadlineExceeded) {
+			return 0
+		}
+		//没有状态码的表示请求没有成功，是连接、超时等错误
+		if resp.StatusCode == 0 && g.errorCacheTime > 0 {
+			return min(g.errorCacheTime, defaultMaxCacheTime)
+		}
+		return 0
+	}
+	if g.negativeCacheTime <= 0 {
+		return 0
+	}
+	isNotFound := false
+	if g.negativeCheckFunc != nil {
+		isNotFound = g.negativeCheckFunc(resp)
+	} else {
+		for _, status := range negativeCacheStatus {
+			if resp.StatusCode == status {
+				isNotFound = true
+				break
+			}
+		}
+	}
+	if !isNotFound {
+		return 0
+	}
+	return min(g.negativeCacheTime, defaultMaxCacheTime)
+}
+
+// setNegativeDataToCache 缓存not found或者请求错误的结果，取出时原样返回状态码和错误，
+// 后台刷新失败时不覆盖还可以使用的缓存，stale-if-error 需要用到
+func (g *genRequest) setNegativeDataToCache(ctx context.Context, p *Response, cacheTime time.Duration) {
+	if g.cacheRefresh {
+		if cacheData, _ := g.getDataFromCache(ctx, p.CacheKey); cacheData != nil && !cacheData.Negative {
+			return
+		}
+	}
+	cacheData := newResponseCacheStruct(p)
+	cacheData.Negative = true
+	cacheData.ExpireTime = cacheData.CreateTime.Add(cacheTime)
+	if p.Error != nil {
+		cacheData.Error = p.Error.Error()
+	}
+	g.saveCacheData(ctx, p, cacheData, cacheTime)
+}
@@ -0,0 +1,113 @@
+package curl
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding/htmlindex"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+var (
+	charsetSniffLength = 1024 //在前面这么多字节中查找html的meta或者xml的声明
+
+	charsetMetaRegexp = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-zA-Z0-9_:.\-]+)`)
+	charsetXmlRegexp  = regexp.MustCompile(`(?i)<\?xml[^>]+encoding\s*=\s*["']([a-zA-Z0-9_:.\-]+)["']`)
+
+	bomUtf8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUtf16BE = []byte{0xFE, 0xFF}
+	bomUtf16LE = []byte{0xFF, 0xFE}
+)
+
+// SetRespCharset 指定返回内容的字符集，比如 gbk，不使用 Content-Type、meta、BOM 的判断，
+// 设置为 utf-8 时不转换
+func (g *genRequest) SetRespCharset(charset string) *genRequest {
+	g.respCharset = charset
+	return g
+}
+
+// RawBody 返回转为utf-8之前的原始内容，已经解压，缓存中没有原始内容时与 Response 相同
+func (r *Response) RawBody() []byte {
+	if r.body != nil {
+		return r.body
+	}
+	return []byte(r.Response)
+}
+
+// setCacheBody 用缓存的内容填充返回值，有原始内容时按本次请求的字符集重新转换，需要先设置Header
+func (r *Response) setCacheBody(text string, raw []byte) {
+	r.body = raw
+	if raw == nil {
+		r.Response = text
+		return
+	}
+	r.Response = string(r.decodeCharset(r.Header.Get(headerContentType), raw))
+}
+
+// decodeCharset 把返回内容转为utf-8，判断顺序：SetRespCharset、BOM、Content-Type、html的meta或xml的声明，
+// 没有找到字符集或者不支持的字符集时返回原始内容
+func (r *Response) decodeCharset(contentType string, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	name := r.charset
+	if name == "" {
+		name, body = detectCharset(contentType, body)
+	}
+	if name == "" {
+		return body
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return body
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+		return bytes.TrimPrefix(body, bomUtf8)
+	}
+	newBody, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body
+	}
+	return newBody
+}
+
+// detectCharset 返回字符集，以及去掉BOM以后的内容
+func detectCharset(contentType string, body []byte) (string, []byte) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if !isTextMediaType(mediaType) {
+		return params["charset"], body
+	}
+	switch {
+	case bytes.HasPrefix(body, bomUtf8):
+		return "utf-8", body[len(bomUtf8):]
+	case bytes.HasPrefix(body, bomUtf16BE):
+		return "utf-16be", body[len(bomUtf16BE):]
+	case bytes.HasPrefix(body, bomUtf16LE):
+		return "utf-16le", body[len(bomUtf16LE):]
+	}
+	if charset := params["charset"]; charset != "" {
+		return charset, body
+	}
+
+	head := body[:min(len(body), charsetSniffLength)]
+	if m := charsetXmlRegexp.FindSubmatch(head); m != nil {
+		return string(m[1]), body
+	}
+	if m := charsetMetaRegexp.FindSubmatch(head); m != nil {
+		return string(m[1]), body
+	}
+	return "", body
+}
+
+// isTextMediaType 文本类型才需要查找BOM和meta，避免二进制数据被误判，没有Content-Type时也查找
+func isTextMediaType(mediaType string) bool {
+	if mediaType == "" || strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, one := range []string{"json", "xml", "html", "javascript"} {
+		if strings.Contains(mediaType, one) {
+			return true
+		}
+	}
+	return false
+}
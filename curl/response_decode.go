@@ -0,0 +1,197 @@
+package curl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	headerAcceptEncoding  = "Accept-Encoding"
+	defaultAcceptEncoding = "gzip, deflate, br, zstd"
+
+	defaultMaxDecodedSize int64 = 100 << 20 //解压后默认最大100M，避免解压炸弹
+)
+
+// ErrDecodedTooLarge 解压后的返回内容超过了限制
+var ErrDecodedTooLarge = errors.New("decoded response body too large")
+
+// WithMaxDecodedSize 设置解压后返回内容的最大字节数，超过时返回 ErrDecodedTooLarge，小于0表示不限制
+func (c *client) WithMaxDecodedSize(size int64) *client {
+	c.maxDecodedSize = size
+	return c
+}
+
+// OriginalSize 返回内容解压前的字节数，从缓存中取得时为0
+func (r *Response) OriginalSize() int64 {
+	return r.originalSize
+}
+
+// DecodedSize 返回内容解压后的字节数，从缓存中取得时为0
+func (r *Response) DecodedSize() int64 {
+	return r.decodedSize
+}
+
+// initAcceptEncoding 没有设置 Accept-Encoding 时，设置支持的压缩方式，由 decodeRespBody 解压
+func initAcceptEncoding(req *http.Request) {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if req.Header.Get(headerAcceptEncoding) == "" {
+		req.Header.Set(headerAcceptEncoding, defaultAcceptEncoding)
+	}
+}
+
+// decodeRespBody 按 Content-Encoding 返回流式解压的reader，解压后的内容超过maxSize时读取返回 ErrDecodedTooLarge，
+// 多次压缩时从外层开始解压，遇到不支持的压缩方式就停止，Content-Encoding 只保留没有解压的部分
+func decodeRespBody(resp *http.Response, body io.Reader, maxSize int64) (io.Reader, func(), error) {
+	closeList := make([]io.Closer, 0)
+	closeFunc := func() {
+		for i := len(closeList) - 1; i >= 0; i-- {
+			_ = closeList[i].Close()
+		}
+	}
+	encoding := strings.TrimSpace(resp.Header.Get(headerContentEncoding))
+	if encoding == "" {
+		return body, closeFunc, nil
+	}
+	//没有内容时不需要解压
+	br := bufio.NewReader(body)
+	if _, err := br.Peek(1); err != nil {
+		return br, closeFunc, nil
+	}
+
+	encodingList := strings.Split(encoding, ",")
+	reader := io.Reader(br)
+	i := len(encodingList) - 1
+	for ; i >= 0; i-- {
+		rc, ok, err := newDecodeReader(strings.TrimSpace(encodingList[i]), reader)
+		if err != nil {
+			closeFunc()
+			return nil, nil, err
+		}
+		if !ok {
+			break
+		}
+		closeList = append(closeList, rc)
+		reader = rc
+	}
+	if i == len(encodingList)-1 {
+		return reader, closeFunc, nil
+	}
+
+	if i >= 0 {
+		remainList := make([]string, 0, i+1)
+		for _, one := range encodingList[:i+1] {
+			remainList = append(remainList, strings.TrimSpace(one))
+		}
+		resp.Header.Set(headerContentEncoding, strings.Join(remainList, ", "))
+	} else {
+		resp.Header.Del(headerContentEncoding)
+		resp.Uncompressed = true
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+
+	if maxSize == 0 {
+		maxSize = defaultMaxDecodedSize
+	}
+	if maxSize > 0 {
+		reader = &maxSizeReader{r: reader, n: maxSize}
+	}
+	return reader, closeFunc, nil
+}
+
+// countReader 记录读取的字节数
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// maxSizeReader 最多读取n个字节，还有更多内容时返回 ErrDecodedTooLarge
+type maxSizeReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxSizeReader) Read(b []byte) (int, error) {
+	if m.n <= 0 {
+		var one [1]byte
+		n, err := m.r.Read(one[:])
+		if n > 0 {
+			return 0, ErrDecodedTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(b)) > m.n {
+		b = b[:m.n]
+	}
+	n, err := m.r.Read(b)
+	m.n -= int64(n)
+	return n, err
+}
+
+// newDecodeReader 解压的reader，流式读取时也可以使用，返回false表示不支持的压缩方式
+func newDecodeReader(encoding string, r io.Reader) (io.ReadCloser, bool, error) {
+	switch strings.ToLower(encoding) {
+	case "", "identity":
+		return io.NopCloser(r), true, nil
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, true, err
+		}
+		return gr, true, nil
+	case "deflate":
+		//标准的deflate是zlib格式，有的服务端直接返回原始的deflate数据
+		br := newPeekReader(r)
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr, true, nil
+		}
+		return flate.NewReader(br.reset()), true, nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), true, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, true, err
+		}
+		return zr.IOReadCloser(), true, nil
+	}
+	return nil, false, nil
+}
+
+// peekReader 记录读取过的数据，可以重新从头读取
+type peekReader struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func newPeekReader(r io.Reader) *peekReader {
+	return &peekReader{r: r}
+}
+
+func (p *peekReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.buf.Write(b[:n])
+	return n, err
+}
+
+// reset 从头读取
+func (p *peekReader) reset() io.Reader {
+	return io.MultiReader(bytes.NewReader(p.buf.Bytes()), p.r)
+}
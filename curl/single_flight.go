@@ -0,0 +1,60 @@
+package curl
+
+import (
+	"context"
+	"errors"
+	"github.com/magic-lib/go-plat-utils/goroutines"
+	"sync"
+	"time"
+)
+
+var errSingleFlightNoResponse = errors.New("single flight request has no response")
+
+// singleFlightCall 正在进行中的请求
+type singleFlightCall struct {
+	done chan struct{}
+	resp *Response
+}
+
+// singleFlightGroup 相同key的并发请求合并为一次请求
+type singleFlightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*singleFlightCall
+}
+
+// do 执行请求，已有相同key的请求在进行时等待其结果，每个等待者拿到各自的拷贝，
+// ctx取消只影响当前等待者，实际请求会继续完成并返回给其他等待者，最长执行timeout
+func (s *singleFlightGroup) do(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) *Response) (*Response, error) {
+	s.mu.Lock()
+	if s.calls == nil {
+		s.calls = make(map[string]*singleFlightCall)
+	}
+	c, ok := s.calls[key]
+	if !ok {
+		c = &singleFlightCall{done: make(chan struct{})}
+		s.calls[key] = c
+		goroutines.GoAsync(func(params ...interface{}) {
+			defer func() {
+				s.mu.Lock()
+				delete(s.calls, key)
+				s.mu.Unlock()
+				close(c.done)
+			}()
+			//不受发起者取消的影响，但需要有超时，避免上游一直不返回
+			leaderCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+			defer cancel()
+			c.resp = fn(leaderCtx)
+		})
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-c.done:
+		if c.resp == nil {
+			return nil, errSingleFlightNoResponse
+		}
+		return c.resp.clone(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,200 @@
+package curl
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	SoapVersion11 = "1.1"
+	SoapVersion12 = "1.2"
+)
+
+var (
+	soapNamespace11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	soapNamespace12 = "http://www.w3.org/2003/05/soap-envelope"
+
+	headerSoapAction = "SOAPAction"
+)
+
+// soapConfig SOAP请求的设置
+type soapConfig struct {
+	version string
+	action  string
+}
+
+// SoapFault SOAP返回的fault，1.1 和 1.2 的字段统一到一起
+type SoapFault struct {
+	Version    string
+	StatusCode int
+	Code       string //1.1的faultcode，1.2的Code/Value
+	Subcode    string //1.2的Code/Subcode/Value
+	Reason     string //1.1的faultstring，1.2的Reason/Text
+	Actor      string //1.1的faultactor，1.2的Role
+	Node       string //1.2的Node
+	Detail     string //detail中的原始xml
+}
+
+func (f *SoapFault) Error() string {
+	code := f.Code
+	if f.Subcode != "" {
+		code += "/" + f.Subcode
+	}
+	return fmt.Sprintf("soap fault: %s, %s", code, f.Reason)
+}
+
+// soapFaultXml 按本地名称匹配，兼容 1.1 和 1.2
+type soapFaultXml struct {
+	FaultCode   string `xml:"faultcode"`
+	FaultString string `xml:"faultstring"`
+	FaultActor  string `xml:"faultactor"`
+	Detail11    struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"detail"`
+
+	Code struct {
+		Value   string `xml:"Value"`
+		Subcode struct {
+			Value string `xml:"Value"`
+		} `xml:"Subcode"`
+	} `xml:"Code"`
+	Reason struct {
+		Text []string `xml:"Text"`
+	} `xml:"Reason"`
+	Node     string `xml:"Node"`
+	Role     string `xml:"Role"`
+	Detail12 struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"Detail"`
+}
+
+// soapEnvelopeXml 解析返回的envelope
+type soapEnvelopeXml struct {
+	XMLName xml.Name
+	Body    struct {
+		Inner []byte        `xml:",innerxml"`
+		Fault *soapFaultXml `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// SetSOAP 把data放在SOAP envelope中提交，version为 SoapVersion11 或 SoapVersion12，
+// 1.1 设置 SOAPAction 请求头，1.2 把action放在 Content-Type 中，data为字符串时去掉xml声明后作为Body的内容，
+// 返回的fault会解析为 *SoapFault 放在 Response.Error 中
+func (g *genRequest) SetSOAP(version string, action string, data interface{}) *genRequest {
+	if version != SoapVersion12 {
+		version = SoapVersion11
+	}
+	g.soap = &soapConfig{version: version, action: action}
+	g.Data = data
+
+	if version == SoapVersion11 {
+		g.bodyContentType = "text/xml; charset=utf-8"
+		if g.Header == nil || g.Header.Get(headerSoapAction) == "" {
+			g.SetHeaders(map[string]string{headerSoapAction: `"` + action + `"`})
+		}
+	} else {
+		g.bodyContentType = "application/soap+xml; charset=utf-8"
+		if action != "" {
+			g.bodyContentType += `; action="` + action + `"`
+		}
+	}
+	g.bodyRaw = false
+	return g
+}
+
+// UnmarshalSOAPBody 把返回的 envelope 中 Body 的内容解码到v
+func (r *Response) UnmarshalSOAPBody(v interface{}) error {
+	if r.Error != nil {
+		return r.Error
+	}
+	env, err := parseSoapEnvelope(r.Response)
+	if err != nil {
+		return err
+	}
+	return newXmlDecoder(env.Body.Inner).Decode(v)
+}
+
+// encodeSoapEnvelope 生成envelope
+func encodeSoapEnvelope(version string, data interface{}) (string, error) {
+	body, err := encodeXmlBody(data)
+	if err != nil {
+		return "", err
+	}
+	body = stripXmlDeclaration(body)
+	ns := soapNamespace11
+	if version == SoapVersion12 {
+		ns = soapNamespace12
+	}
+	return `<?xml version="1.0" encoding="utf-8"?>` +
+		`<soap:Envelope xmlns:soap="` + ns + `"><soap:Body>` + body + `</soap:Body></soap:Envelope>`, nil
+}
+
+// stripXmlDeclaration 去掉字符串中的xml声明，放在envelope中时只能有一个声明
+func stripXmlDeclaration(body string) string {
+	s := strings.TrimLeft(strings.TrimPrefix(body, "\ufeff"), " \t\r\n")
+	if !strings.HasPrefix(s, "<?xml") {
+		return body
+	}
+	if i := strings.Index(s, "?>"); i >= 0 {
+		return strings.TrimLeft(s[i+2:], " \t\r\n")
+	}
+	return body
+}
+
+// newXmlDecoder 返回内容已经按声明的字符集转为utf-8，xml声明中的encoding不再转换
+func newXmlDecoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return d
+}
+
+func parseSoapEnvelope(data string) (*soapEnvelopeXml, error) {
+	env := new(soapEnvelopeXml)
+	if err := newXmlDecoder([]byte(data)).Decode(env); err != nil {
+		return nil, fmt.Errorf("soap envelope error: %w", err)
+	}
+	if env.XMLName.Local != "Envelope" {
+		return nil, errors.New("soap envelope not found")
+	}
+	return env, nil
+}
+
+// parseSoapFault 返回内容中有fault时返回 *SoapFault，返回内容为空时返回nil，不是envelope时返回错误
+func parseSoapFault(resp *Response) (*SoapFault, error) {
+	if strings.TrimSpace(resp.Response) == "" {
+		return nil, nil
+	}
+	env, err := parseSoapEnvelope(resp.Response)
+	if err != nil {
+		return nil, fmt.Errorf("http status: %d, %w", resp.StatusCode, err)
+	}
+	if env.Body.Fault == nil {
+		return nil, nil
+	}
+	f := env.Body.Fault
+	fault := &SoapFault{StatusCode: resp.StatusCode}
+	if env.XMLName.Space == soapNamespace12 || f.Code.Value != "" {
+		fault.Version = SoapVersion12
+		fault.Code = strings.TrimSpace(f.Code.Value)
+		fault.Subcode = strings.TrimSpace(f.Code.Subcode.Value)
+		if len(f.Reason.Text) > 0 {
+			fault.Reason = strings.TrimSpace(f.Reason.Text[0])
+		}
+		fault.Actor = strings.TrimSpace(f.Role)
+		fault.Node = strings.TrimSpace(f.Node)
+		fault.Detail = strings.TrimSpace(f.Detail12.Inner)
+		return fault, nil
+	}
+	fault.Version = SoapVersion11
+	fault.Code = strings.TrimSpace(f.FaultCode)
+	fault.Reason = strings.TrimSpace(f.FaultString)
+	fault.Actor = strings.TrimSpace(f.FaultActor)
+	fault.Detail = strings.TrimSpace(f.Detail11.Inner)
+	return fault, nil
+}
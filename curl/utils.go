@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/ChengjinWu/gojson"
-	jsoniter "github.com/json-iterator/go"
 	"github.com/magic-lib/go-plat-utils/conv"
 	"github.com/magic-lib/go-plat-utils/logs"
 	"github.com/magic-lib/go-plat-utils/id-generator/id"
@@ -13,26 +12,31 @@ import (
 	"github.com/tidwall/sjson"
 	"net/http"
 	"net/textproto"
-	"net/url"
 	"reflect"
 	"sort"
 	"strings"
 )
 
-// getMethod 请求方法判断
-func getMethod(method string) string {
-	method = strings.ToUpper(method)
-	methodList := []string{
-		http.MethodGet,
-		http.MethodPost,
-		http.MethodDelete,
-		http.MethodHead, http.MethodPut, http.MethodPatch} //允许的方法列表
-	for _, one := range methodList {
-		if one == method {
-			return method
+// getMethod 请求方法判断，为空时使用默认方法，标准方法统一转为大写，不是合法的token时返回错误
+func getMethod(method string) (string, error) {
+	method = normalizeMethod(method)
+	if method == "" {
+		return defaultMethod, nil
+	}
+	for _, r := range method {
+		if !isTokenChar(r) {
+			return method, fmt.Errorf("请求方法不合法：%q", method)
 		}
 	}
-	return defaultMethod
+	return method, nil
+}
+
+// isTokenChar RFC 9110 中token允许的字符
+func isTokenChar(r rune) bool {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
 }
 
 func getHeaders(headers http.Header, method string, data interface{}) http.Header {
@@ -40,8 +44,9 @@ func getHeaders(headers http.Header, method string, data interface{}) http.Heade
 		headers = http.Header{}
 	}
 
+	//没有body的方法不需要设置
 	ct := headers.Get(headerContentType)
-	if ct == "" {
+	if ct == "" && methodDataInBody(method) {
 		isSetType := false
 		dataString, err := getDataString(data)
 		if err == nil {
@@ -59,20 +64,6 @@ func getHeaders(headers http.Header, method string, data interface{}) http.Heade
 				}
 			}
 		}
-	} else {
-		//如果data数据是json，并且不是get的话，则不能是 x-www-form-urlencoded
-		if method != http.MethodGet {
-			if strings.Contains(ct, headerContentTypeFormUrlencodedKey) {
-				dataString, err := getDataString(data)
-				if err == nil {
-					checkJsonError := gojson.CheckValid([]byte(dataString))
-					if checkJsonError == nil {
-						//表示数据是json格式
-						headers.Set(headerContentType, headerContentTypeJsonUtf8)
-					}
-				}
-			}
-		}
 	}
 
 	headers = beautifulHeader(headers)
@@ -158,38 +149,15 @@ func setHeaderValues(h http.Header, key string, values ...string) http.Header {
 	return h
 }
 
-func getNewUrl(url, method string, dataString string) string {
-	if (method != http.MethodGet && method != http.MethodDelete) || dataString == "" {
+// getNewUrl 参数拼接到url后面
+func getNewUrl(url string, param string) string {
+	if param == "" {
 		return url
 	}
-
-	err := gojson.CheckValid([]byte(dataString))
-	param := dataString
-	if err == nil {
-		param2 := make(map[string]interface{})
-		err3 := jsoniter.Unmarshal([]byte(dataString), &param2)
-		if err3 == nil {
-			param = createParamStrOrder(param2)
-		}
-	}
-	newUrl := ""
 	if strings.Index(url, "?") > 0 {
-		newUrl = url + "&" + param
-	} else {
-		newUrl = url + "?" + param
+		return url + "&" + param
 	}
-	return newUrl
-}
-
-// createParamStrOrder 对参数进行排序，然后拼接成URL的字符串
-func createParamStrOrder(params map[string]interface{}) string {
-	aParams := make([]string, 0)
-	for k, v := range params {
-		val := fmt.Sprintf("%v", v)
-		aParams = append(aParams, k+"="+url.QueryEscape(val))
-	}
-	sort.Strings(aParams)
-	return strings.Join(aParams, "&")
+	return url + "?" + param
 }
 
 func printLog(ctx context.Context, loggers logs.ILogger, logLevel logs.LogLevel, printLogInt int, logStr string) {
@@ -238,6 +206,10 @@ func printLoggerResponse(ctx context.Context, cLogger logs.ILogger, defaultPrint
 		}
 	}
 	returnData := conv.String(resp)
+	//有url模板时使用模板，避免url太分散
+	if resp.UrlTemplate != "" {
+		returnData, _ = sjson.Set(returnData, "request.url", resp.UrlTemplate)
+	}
 	//这里默认打上日志，方便查问题，需要将数据量减少，避免默认内容太多了
 	rData := []rune(gjson.Get(returnData, "request.data").String())
 	rHeader := []rune(gjson.Get(returnData, "request.header").String())
@@ -309,7 +281,11 @@ func getRequestId(p *Request) string {
 // getJsonOnlyKey 传入map对象，取得唯一的返回key，用于cache中存储的时候
 func getJsonOnlyKey(data interface{}) string {
 	jsonData := conv.String(data)
-	jsonMap := conv.KeyListFromMap(jsonData)
+	//数字保留原始格式，避免大整数丢失精度以后，不同的请求使用相同的key
+	jsonMap := make(map[string]interface{})
+	if err := jsonNumberApi.Unmarshal([]byte(jsonData), &jsonMap); err != nil {
+		jsonMap = conv.KeyListFromMap(jsonData)
+	}
 	if len(jsonMap) > 0 {
 		return param.HttpBuildQuery(jsonMap)
 	}